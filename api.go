@@ -1,23 +1,36 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httputil"
 	"net/url"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/text/encoding"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -30,14 +43,20 @@ const (
 )
 
 var types = map[string]string{
-	"html":       "text/html",
-	"json":       "application/json",
-	"xml":        "application/xml",
-	"text":       "text/plain",
-	"urlencoded": "application/x-www-form-urlencoded",
-	"form":       "application/x-www-form-urlencoded",
-	"form-data":  "application/x-www-form-urlencoded",
-	"multipart":  "multipart/form-data",
+	"html":        "text/html",
+	"json":        "application/json",
+	"xml":         "application/xml",
+	"text":        "text/plain",
+	"urlencoded":  "application/x-www-form-urlencoded",
+	"form":        "application/x-www-form-urlencoded",
+	"form-data":   "application/x-www-form-urlencoded",
+	"multipart":   "multipart/form-data",
+	"yaml":        "application/yaml",
+	"msgpack":     "application/msgpack",
+	"protobuf":    "application/x-protobuf",
+	"cbor":        "application/cbor",
+	"merge-patch": "application/merge-patch+json",
+	"json-patch":  "application/json-patch+json",
 }
 
 type RequestProcessorDeferHandler func()
@@ -52,34 +71,78 @@ type Cipher interface {
 const CIPHER_HEADER = "X-CIPHER-ENCODED"
 
 type Agent struct {
-	u             *url.URL
-	t             string
-	m             string
-	prefix        string
-	headerIn      http.Header
-	headerOut     http.Header
-	query         url.Values
-	cookies       []*http.Cookie
-	files         []*File
-	data          io.Reader
-	length        int
-	cipher        Cipher
-	Error         error
-	debug         bool
-	client        *http.Client
-	reqProcessor  RequestProcessor
-	respProcessor ResponseProcessor
+	u               *url.URL
+	t               string
+	m               string
+	prefix          string
+	headerIn        http.Header
+	headerOut       http.Header
+	defaultHeaders  http.Header
+	query           url.Values
+	cookies         []*http.Cookie
+	files           []*File
+	fields          []formField
+	detectFileType  bool
+	data            io.Reader
+	length          int
+	cipher          Cipher
+	redact          map[string]bool
+	logger          func(format string, args ...interface{})
+	tee             io.Writer
+	requestID       string
+	noBodyOnGet     bool
+	requestIDHeader string
+	compress        string
+	Error           error
+	debug           bool
+	ctx             context.Context
+	timeout         time.Duration
+	maxBodyBytes    int64
+	errorBodyLimit  int
+	uploadProgress  ProgressFunc
+	signer          signer
+	oauth2          *oauth2Source
+	tracer          *tracer
+	middlewares     []Middleware
+	propagators     []Propagator
+	limiter         *rate.Limiter
+	digest          *digestAuth
+	jsonMarshal     func(interface{}) ([]byte, error)
+	jsonUnmarshal   func([]byte, interface{}) error
+	strictJSON      bool
+	useNumber       bool
+	charset         encoding.Encoding
+	checksum        *checksum
+	cache           *responseCache
+	fromCache       bool
+	breaker         *circuitBreaker
+	group           *singleflight.Group
+	retryMax        int
+	retryBudget     time.Duration
+	retryCodes      []int
+	expect          []int
+	backoff         Backoff
+	client          *http.Client
+	reqProcessor    RequestProcessor
+	respProcessor   ResponseProcessor
+	urlProcessor    func(*url.URL) error
 }
 
+// URL creates an agent for aurl. A unix:///path/to.sock:/http/path URL
+// sends the requests for /http/path to the unix socket /path/to.sock.
 func URL(aurl string) *Agent {
 	u, err := url.Parse(aurl)
 	if err != nil {
 		panic(err)
 	}
+	socket := ""
+	if u.Scheme == "unix" {
+		socket, u = splitUnixURL(u)
+	}
 	prefix := strings.TrimSuffix(u.Path, "/")
-	return &Agent{
+	a := &Agent{
 		u:         u,
-		t:         types["html"],
+		t:         "html",
 		m:         GET,
 		prefix:    prefix,
 		headerIn:  make(map[string][]string),
@@ -88,8 +151,40 @@ func URL(aurl string) *Agent {
 		cookies:   make([]*http.Cookie, 0),
 		files:     make([]*File, 0),
 		Error:     err,
-		client:    http.DefaultClient,
+		client:    getDefaultClient(),
+	}
+	if socket != "" {
+		a.UnixSocket(socket)
+	}
+	return a
+}
+
+// Clone returns a copy of the agent that can be configured and sent
+// independently. URL, headers, query, cookies and files are deep-copied,
+// while the client and cipher are shared. The request body is not copied.
+// Treat the original as a template: configure it once, then Clone it for
+// each request, possibly from several goroutines.
+func (a *Agent) Clone() *Agent {
+	c := *a
+	u := *a.u
+	c.u = &u
+	c.headerIn = a.headerIn.Clone()
+	c.headerOut = make(map[string][]string)
+	c.defaultHeaders = a.defaultHeaders.Clone()
+	c.query = url.Values(http.Header(a.query).Clone())
+	c.cookies = append(make([]*http.Cookie, 0, len(a.cookies)), a.cookies...)
+	c.files = append(make([]*File, 0, len(a.files)), a.files...)
+	c.fields = append([]formField(nil), a.fields...)
+	c.retryCodes = append([]int(nil), a.retryCodes...)
+	c.expect = append([]int(nil), a.expect...)
+	c.middlewares = append([]Middleware(nil), a.middlewares...)
+	c.propagators = append([]Propagator(nil), a.propagators...)
+	c.data = nil
+	c.length = 0
+	if a.tracer != nil {
+		c.tracer = &tracer{}
 	}
+	return &c
 }
 
 func Get(aurl string) *Agent {
@@ -112,6 +207,16 @@ func Head(aurl string) *Agent {
 	return URL(aurl).Method(HEAD)
 }
 
+// GetJSON gets aurl and decodes the JSON response into out.
+func GetJSON(ctx context.Context, aurl string, out interface{}) (int, error) {
+	return Get(aurl).ContextJSON(ctx, out)
+}
+
+// PostJSON posts in as JSON to aurl and decodes the JSON response into out.
+func PostJSON(ctx context.Context, aurl string, in, out interface{}) (int, error) {
+	return Post(aurl).JSONData(in).ContextJSON(ctx, out)
+}
+
 func HTTP(host string) *Agent {
 	return URL(fmt.Sprintf("http://%s", host))
 }
@@ -134,6 +239,14 @@ func (a *Agent) ResponseProcessor(processor ResponseProcessor) *Agent {
 	return a
 }
 
+// URLProcessor sets fn to rewrite the request URL once the query is
+// encoded, before auth, cookies and signing, for instance to sign it. An
+// error of fn aborts the request.
+func (a *Agent) URLProcessor(fn func(*url.URL) error) *Agent {
+	a.urlProcessor = fn
+	return a
+}
+
 func (a *Agent) Prefix(prefix string) *Agent {
 	a.prefix = strings.TrimSuffix(prefix, "/")
 	return a
@@ -146,18 +259,153 @@ func (a *Agent) Transport(tr http.RoundTripper) *Agent {
 	return a
 }
 
+// Context sets the context of the terminal methods without a context
+// argument, such as Bytes, Text, JSON or Download. It defaults to
+// context.Background(). Every such method X has a ContextX variant taking
+// the context explicitly, which is used instead of this one.
+func (a *Agent) Context(ctx context.Context) *Agent {
+	a.ctx = ctx
+	return a
+}
+
+func (a *Agent) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// Timeout sets a deadline for the whole request, including reading the
+// response body. It is applied through the request context, so it never
+// mutates a shared http.Client.
+func (a *Agent) Timeout(d time.Duration) *Agent {
+	a.timeout = d
+	return a
+}
+
+// CookieJar installs jar on a copy of the agent's client, so cookies set
+// by responses are sent on subsequent requests sharing the same jar.
+func (a *Agent) CookieJar(jar http.CookieJar) *Agent {
+	client := a.cloneClient()
+	client.Jar = jar
+	a.client = client
+	return a
+}
+
+// ErrTooManyRedirects is returned when a request is redirected more times
+// than allowed by FollowRedirects.
+var ErrTooManyRedirects = errors.New("api: too many redirects")
+
+// FollowRedirects limits how many redirects are followed. With max < 0
+// redirects are never followed and the 3xx response is returned as is.
+func (a *Agent) FollowRedirects(max int) *Agent {
+	client := a.cloneClient()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if max < 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > max {
+			return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, max)
+		}
+		return nil
+	}
+	a.client = client
+	return a
+}
+
+// NewCookieJar returns an in-memory cookie jar.
+func NewCookieJar() http.CookieJar {
+	jar, _ := cookiejar.New(nil)
+	return jar
+}
+
+func (a *Agent) cloneClient() *http.Client {
+	client := *a.client
+	return &client
+}
+
 func (a *Agent) Debug(flag bool) *Agent {
 	a.debug = flag
 	return a
 }
 func (a *Agent) URI(uri string) *Agent {
 	a.u.Path = uri
+	a.u.RawPath = ""
 	if len(a.prefix) > 0 {
 		a.u.Path = a.prefix + uri
 	}
 	return a
 }
 
+// Path appends segments to the current path, prefix included, with a single
+// slash between them. Each segment is path escaped, keeping the escapes it
+// may already contain, and slashes inside it separate further segments. A
+// trailing slash on the last segment is kept.
+func (a *Agent) Path(segments ...string) *Agent {
+	escaped := strings.TrimSuffix(a.u.EscapedPath(), "/")
+	for _, segment := range segments {
+		for _, part := range strings.Split(segment, "/") {
+			if part == "" {
+				continue
+			}
+			raw, err := url.PathUnescape(part)
+			if err != nil {
+				raw = part
+			}
+			escaped += "/" + url.PathEscape(raw)
+		}
+	}
+	if n := len(segments); n > 0 && strings.HasSuffix(segments[n-1], "/") {
+		escaped += "/"
+	}
+
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	a.u.Path = path
+	a.u.RawPath = escaped
+	return a
+}
+
+// URITemplate sets the path from tmpl, replacing each {name} placeholder
+// with the path escaped value of params[name]. A missing parameter sets
+// the agent's Error.
+func (a *Agent) URITemplate(tmpl string, params map[string]string) *Agent {
+	var escaped strings.Builder
+	for {
+		start := strings.Index(tmpl, "{")
+		if start < 0 {
+			escaped.WriteString(tmpl)
+			break
+		}
+		end := strings.Index(tmpl[start:], "}")
+		if end < 0 {
+			a.Error = fmt.Errorf("api: unclosed parameter in uri template %q", tmpl)
+			return a
+		}
+		name := tmpl[start+1 : start+end]
+		value, ok := params[name]
+		if !ok {
+			a.Error = fmt.Errorf("api: missing uri parameter %q", name)
+			return a
+		}
+		escaped.WriteString(tmpl[:start])
+		escaped.WriteString(url.PathEscape(value))
+		tmpl = tmpl[start+end+1:]
+	}
+
+	path, err := url.PathUnescape(escaped.String())
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	a.URI(path)
+	a.u.RawPath = (&url.URL{Path: a.prefix}).EscapedPath() + escaped.String()
+	return a
+}
+
 func (a *Agent) QueryGet() url.Values {
 	q := a.u.Query()
 	for k, v := range a.query {
@@ -188,6 +436,16 @@ func (a *Agent) QueryDel(key string) *Agent {
 	return a
 }
 
+// SetQuery adds all values to the query, like SetHead does for headers.
+func (a *Agent) SetQuery(values url.Values) *Agent {
+	for k, vs := range values {
+		for _, v := range vs {
+			a.query.Add(k, v)
+		}
+	}
+	return a
+}
+
 func (a *Agent) SetHead(hdr http.Header) *Agent {
 	for k, vs := range hdr {
 		for _, v := range vs {
@@ -197,6 +455,34 @@ func (a *Agent) SetHead(hdr http.Header) *Agent {
 	return a
 }
 
+// DefaultHeaders sets headers added to every request unless the same
+// header was set on the agent. Unlike SetHead they are merged when the
+// request is sent, so later HeadSet calls, for instance on a Clone, win.
+func (a *Agent) DefaultHeaders(hdr http.Header) *Agent {
+	a.defaultHeaders = make(http.Header)
+	for k, vs := range hdr {
+		for _, v := range vs {
+			a.defaultHeaders.Add(k, v)
+		}
+	}
+	return a
+}
+
+// Accept sets the Accept header, either by a short name from the types map
+// such as "json" or by a full MIME type. Without it, the decoding methods
+// such as JSON or XML send the type they decode.
+func (a *Agent) Accept(contentType string) *Agent {
+	a.headerIn.Set("Accept", mimeType(contentType))
+	return a
+}
+
+type acceptKey struct{}
+
+// withAccept carries the Accept header used when none is set on the agent.
+func withAccept(ctx context.Context, accept string) context.Context {
+	return context.WithValue(ctx, acceptKey{}, accept)
+}
+
 func (a *Agent) HeadSet(key string, value string) *Agent {
 	a.headerIn.Set(key, value)
 	return a
@@ -212,13 +498,41 @@ func (a *Agent) HeadDel(key string) *Agent {
 	return a
 }
 
+// BasicAuthSet sets basic auth credentials, see BasicAuthHeader.
 func (a *Agent) BasicAuthSet(user, password string) *Agent {
-	a.u.User = url.UserPassword(user, password)
+	return a.BasicAuthHeader(user, password)
+}
+
+// BasicAuthHeader sets the Authorization header to basic auth credentials,
+// replacing any bearer token. Unlike credentials in the URL userinfo, they
+// never show up in the request URL.
+func (a *Agent) BasicAuthHeader(user, password string) *Agent {
+	a.u.User = nil
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	a.headerIn.Set("Authorization", "Basic "+auth)
 	return a
 }
 
 func (a *Agent) BasicAuthDel() *Agent {
 	a.u.User = nil
+	if strings.HasPrefix(a.headerIn.Get("Authorization"), "Basic ") {
+		a.headerIn.Del("Authorization")
+	}
+	return a
+}
+
+// BearerToken sets the Authorization header to "Bearer <token>", replacing
+// any basic auth credentials.
+func (a *Agent) BearerToken(token string) *Agent {
+	a.BasicAuthDel()
+	a.headerIn.Set("Authorization", "Bearer "+token)
+	return a
+}
+
+func (a *Agent) BearerTokenDel() *Agent {
+	if strings.HasPrefix(a.headerIn.Get("Authorization"), "Bearer ") {
+		a.headerIn.Del("Authorization")
+	}
 	return a
 }
 
@@ -232,15 +546,39 @@ func (a *Agent) Method(m string) *Agent {
 	return a
 }
 
+// AllowBodyOnGet sets whether a GET request may carry a body. Bodies are
+// sent on GET by default, as search APIs like Elasticsearch expect; with
+// false, a GET with a body fails to build instead of sending it by accident.
+func (a *Agent) AllowBodyOnGet(allow bool) *Agent {
+	a.noBodyOnGet = !allow
+	return a
+}
+
+// ContentType sets the request body type, either by a short name from the
+// types map such as "json" or by a full MIME type.
 func (a *Agent) ContentType(t string) *Agent {
+	if _, ok := types[t]; ok || strings.Contains(t, "/") {
+		a.t = t
+	}
+	return a
+}
+
+func mimeType(t string) string {
 	if ct, ok := types[t]; ok {
-		a.m = ct
+		return ct
 	}
+	return t
+}
+
+// SetClient makes the agent send requests with client as is, keeping its
+// Timeout, Jar and CheckRedirect settings.
+func (a *Agent) SetClient(client *http.Client) *Agent {
+	a.client = client
 	return a
 }
 
 func (a *Agent) SetHttpClient(client *http.Client) {
-	a.client = client
+	a.SetClient(client)
 }
 
 func (a *Agent) FormData(form map[string][]string) *Agent {
@@ -251,8 +589,30 @@ func (a *Agent) FormData(form map[string][]string) *Agent {
 	return a
 }
 
+// RawData sends data verbatim as the request body with the given content
+// type, either a MIME type or a short name of ContentType.
+func (a *Agent) RawData(contentType string, data []byte) *Agent {
+	a.data = bytes.NewReader(data)
+	a.length = len(data)
+	a.t = contentType
+	return a
+}
+
+// Stream sends the body read from r with chunked transfer encoding and no
+// Content-Length, without buffering it. The buffered bodies of FormData,
+// JSONData and the like are sent with their Content-Length instead.
+func (a *Agent) Stream(r io.Reader) *Agent {
+	a.data = r
+	a.length = -1
+	return a
+}
+
 func JSONMarshal(v interface{}, unescape bool) ([]byte, error) {
-	b, err := json.Marshal(v)
+	return jsonMarshal(json.Marshal, v, unescape)
+}
+
+func jsonMarshal(marshal func(interface{}) ([]byte, error), v interface{}, unescape bool) ([]byte, error) {
+	b, err := marshal(v)
 
 	if unescape {
 		b = bytes.Replace(b, []byte("\\u003c"), []byte("<"), -1)
@@ -262,48 +622,268 @@ func JSONMarshal(v interface{}, unescape bool) ([]byte, error) {
 	return b, err
 }
 
+// JSONCodec replaces encoding/json for JSON request and response bodies,
+// for instance with jsoniter or a decoder rejecting unknown fields. It must
+// be set before JSONData.
+func (a *Agent) JSONCodec(marshal func(interface{}) ([]byte, error), unmarshal func([]byte, interface{}) error) *Agent {
+	a.jsonMarshal = marshal
+	a.jsonUnmarshal = unmarshal
+	return a
+}
+
+func (a *Agent) marshalJSON(v interface{}, unescape bool) ([]byte, error) {
+	if a.jsonMarshal != nil {
+		return jsonMarshal(a.jsonMarshal, v, unescape)
+	}
+	return JSONMarshal(v, unescape)
+}
+
+func (a *Agent) decodeJSON(rd io.Reader, obj interface{}) error {
+	if a.jsonUnmarshal != nil {
+		body, err := ioutil.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+		return a.jsonUnmarshal(body, obj)
+	}
+	dec := json.NewDecoder(rd)
+	if a.strictJSON {
+		dec.DisallowUnknownFields()
+	}
+	if a.useNumber {
+		dec.UseNumber()
+	}
+	return dec.Decode(obj)
+}
+
+// skipEmpty reports whether the body is empty or only whitespace, which
+// JSON and XML treat as no content instead of a decoding error. Otherwise
+// it returns a reader of the body with the leading whitespace skipped.
+func skipEmpty(rd io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReader(rd)
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return nil, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		br.UnreadByte()
+		return br, false, nil
+	}
+}
+
+// StrictJSON makes JSON response decoding fail on fields missing from the
+// target struct. It has no effect with a JSONCodec.
+func (a *Agent) StrictJSON(enabled bool) *Agent {
+	a.strictJSON = enabled
+	return a
+}
+
+// UseNumber decodes JSON numbers into interface{} values as json.Number
+// instead of float64, keeping large integer IDs exact. It has no effect with
+// a JSONCodec.
+func (a *Agent) UseNumber(enabled bool) *Agent {
+	a.useNumber = enabled
+	return a
+}
+
+// dataError names the *Data method and the type of the value that failed
+// to marshal, nil for a nil err.
+func dataError(method string, v interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("api: %s marshal %T: %w", method, v, err)
+}
+
 func (a *Agent) JSONData(args ...interface{}) *Agent {
 	if len(args) == 1 {
-		data, err := JSONMarshal(args[0], false)
+		data, err := a.marshalJSON(args[0], false)
 		a.data = bytes.NewBuffer(data)
 		a.length = len(data)
-		a.Error = err
+		a.Error = dataError("JSONData", args[0], err)
 	}
 
 	if len(args) == 2 {
-		data, err := JSONMarshal(args[0], args[1].(bool))
+		data, err := a.marshalJSON(args[0], args[1].(bool))
 		a.data = bytes.NewBuffer(data)
 		a.length = len(data)
-		a.Error = err
+		a.Error = dataError("JSONData", args[0], err)
 	}
 	a.t = "json"
 	return a
 }
 
+// JSONDataIndent is JSONData with the body indented like json.MarshalIndent,
+// for human readers. Pass unescape true to keep <, > and & unescaped.
+func (a *Agent) JSONDataIndent(v interface{}, prefix, indent string, unescape ...bool) *Agent {
+	data, err := a.marshalJSON(v, len(unescape) > 0 && unescape[0])
+	if err == nil {
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, data, prefix, indent); err == nil {
+			data = buf.Bytes()
+		}
+	}
+	a.data = bytes.NewBuffer(data)
+	a.length = len(data)
+	a.Error = dataError("JSONDataIndent", v, err)
+	a.t = "json"
+	return a
+}
+
 func (a *Agent) PBData(obj proto.Message) *Agent {
 	buf := bytes.NewBuffer([]byte{})
 	marshaler := &jsonpb.Marshaler{EmitDefaults: true}
 	err := marshaler.Marshal(buf, obj)
 	a.data = buf
-	a.Error = err
+	a.Error = dataError("PBData", obj, err)
 	a.length = buf.Len()
 	a.t = "json"
 	return a
 }
 
+func (a *Agent) ProtobufData(obj proto.Message) *Agent {
+	data, err := proto.Marshal(obj)
+	a.data = bytes.NewBuffer(data)
+	a.length = len(data)
+	a.Error = dataError("ProtobufData", obj, err)
+	a.t = "protobuf"
+	return a
+}
+
+// MergePatch sends v as a PATCH request body of type
+// application/merge-patch+json (RFC 7396).
+func (a *Agent) MergePatch(v interface{}) *Agent {
+	a.m = PATCH
+	a.JSONData(v)
+	a.t = "merge-patch"
+	return a
+}
+
+// PatchOp is an operation of a JSON Patch document (RFC 6902).
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON leaves out the value of remove, move and copy operations
+// only, so add, replace and test keep a null value.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	type patchOp PatchOp
+	switch op.Op {
+	case "remove", "move", "copy":
+		return json.Marshal(struct {
+			patchOp
+			Value interface{} `json:"value,omitempty"`
+		}{patchOp: patchOp(op)})
+	}
+	return json.Marshal(patchOp(op))
+}
+
+// JSONPatch sends ops as a PATCH request body of type
+// application/json-patch+json.
+func (a *Agent) JSONPatch(ops []PatchOp) *Agent {
+	a.m = PATCH
+	a.JSONData(ops)
+	a.t = "json-patch"
+	return a
+}
+
+// Body marshals v according to the content type set by ContentType: XML,
+// YAML, msgpack, protobuf or form encoding, and JSON for anything else. The
+// content type itself is kept, so vendor types like application/vnd.x+xml
+// are sent as set.
+func (a *Agent) Body(v interface{}) *Agent {
+	t := a.t
+	media, _, _ := mime.ParseMediaType(mimeType(t))
+	switch {
+	case media == "application/xml" || media == "text/xml" || strings.HasSuffix(media, "+xml"):
+		a.XMLData(v)
+	case media == "application/yaml" || media == "application/x-yaml" || media == "text/yaml":
+		a.YAMLData(v)
+	case media == "application/msgpack" || media == "application/x-msgpack":
+		a.MsgpackData(v)
+	case media == "application/cbor":
+		a.CBORData(v)
+	case media == "application/x-protobuf" || media == "application/protobuf":
+		msg, ok := v.(proto.Message)
+		if !ok {
+			a.Error = fmt.Errorf("api: protobuf body needs a proto.Message, got %T", v)
+			return a
+		}
+		a.ProtobufData(msg)
+	case media == "application/x-www-form-urlencoded":
+		switch form := v.(type) {
+		case url.Values:
+			a.FormData(form)
+		case map[string][]string:
+			a.FormData(form)
+		default:
+			a.FormStruct(v)
+		}
+	case media == "application/json" || strings.HasSuffix(media, "+json"):
+		a.JSONData(v)
+	default:
+		return a.JSONData(v)
+	}
+	a.t = t
+	return a
+}
+
 func (a *Agent) XMLData(obj interface{}) *Agent {
 	data, err := xml.Marshal(obj)
 	a.data = bytes.NewBuffer(data)
 	a.length = len(data)
-	a.Error = err
+	a.Error = dataError("XMLData", obj, err)
 	a.t = "xml"
 	return a
 }
 
+func (a *Agent) YAMLData(obj interface{}) *Agent {
+	data, err := yamlMarshal(obj)
+	a.data = bytes.NewBuffer(data)
+	a.length = len(data)
+	a.Error = dataError("YAMLData", obj, err)
+	a.t = "yaml"
+	return a
+}
+
+// yamlMarshal is yaml.Marshal returning an error instead of panicking on
+// types it cannot marshal, such as channels.
+func yamlMarshal(v interface{}) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return yaml.Marshal(v)
+}
+
+func (a *Agent) MsgpackData(obj interface{}) *Agent {
+	data, err := msgpack.Marshal(obj)
+	a.data = bytes.NewBuffer(data)
+	a.length = len(data)
+	a.Error = dataError("MsgpackData", obj, err)
+	a.t = "msgpack"
+	return a
+}
+
+// File is a multipart file part. Its content is Data, or Reader when set,
+// in which case the request body is streamed instead of buffered.
 type File struct {
-	Filename  string
-	Fieldname string
-	Data      []byte
+	Filename    string
+	Fieldname   string
+	Data        []byte
+	Reader      io.Reader
+	ContentType string
 }
 
 func NewFile(field string, filename string) (*File, error) {
@@ -346,68 +926,187 @@ func NewFileByReader(field string, filename string, rd io.Reader) (*File, error)
 	}, nil
 }
 
+// NewFileStream returns a File read lazily from rd while the request is
+// sent, so uploads use constant memory whatever their size.
+func NewFileStream(field string, filename string, rd io.Reader) (*File, error) {
+	fn := filepath.Base(filename)
+	return &File{
+		Filename:  fn,
+		Fieldname: field,
+		Reader:    rd,
+	}, nil
+}
+
 func (a *Agent) FileData(files ...*File) *Agent {
 	a.files = append(a.files, files...)
 	a.t = "multipart"
 	return a
 }
 
-func (a *Agent) Do(ctx context.Context) (*http.Response, error) {
+// Files reads the file at each path with NewFile and uploads it under its
+// field, in field order. A file that cannot be read sets the agent's Error.
+func (a *Agent) Files(fields map[string]string) *Agent {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file, err := NewFile(name, fields[name])
+		if err != nil {
+			a.Error = fmt.Errorf("api: file field %q from %q: %w", name, fields[name], err)
+			return a
+		}
+		a.FileData(file)
+	}
+	return a
+}
+
+// Request builds the request Do would send, with its body, headers,
+// query, auth, cookies and signature, without sending it.
+func (a *Agent) Request(ctx context.Context) (req *http.Request, err error) {
 	if a.Error != nil {
 		return nil, a.Error
 	}
 
-	content_type := types[a.t]
-	if len(a.files) > 0 {
-		buf := &bytes.Buffer{}
-		mw := multipart.NewWriter(buf)
+	//! checked before a streaming body starts its writer
+	if a.noBodyOnGet && strings.EqualFold(a.m, GET) && (a.data != nil || len(a.files) > 0 || len(a.fields) > 0) {
+		a.Error = errors.New("api: GET request with a body, see AllowBodyOnGet")
+		return nil, a.Error
+	}
 
-		for _, file := range a.files {
-			fw, _ := mw.CreateFormFile(file.Fieldname, file.Filename)
-			fw.Write(file.Data)
+	content_type := mimeType(a.t)
+	body, length := a.data, a.length
+	//! a streaming body feeds a writer goroutine until it is read or closed
+	defer func() {
+		if closer, ok := body.(io.Closer); ok && err != nil {
+			closer.Close()
+		}
+	}()
+	streaming := length < 0
+	if len(a.files) > 0 || len(a.fields) > 0 {
+		fields, files, detect := a.fields, a.files, a.detectFileType
+		if streaming = isStreaming(fields, files); streaming {
+			//! stream the multipart body through a pipe
+			pr, pw := io.Pipe()
+			mw := multipart.NewWriter(pw)
+			go func() {
+				pw.CloseWithError(writeMultipart(mw, fields, files, detect))
+			}()
+			body, length = pr, -1
+			content_type = mw.FormDataContentType()
+		} else {
+			buf := &bytes.Buffer{}
+			mw := multipart.NewWriter(buf)
+			if err := writeMultipart(mw, fields, files, detect); err != nil {
+				a.Error = err
+				return nil, err
+			}
+			body, length = bytes.NewReader(buf.Bytes()), buf.Len()
+			content_type = mw.FormDataContentType()
 		}
-		a.data = buf
-		content_type = mw.FormDataContentType()
-		mw.Close()
+	} else if body != nil && !streaming {
+		//! keep the plain body replayable in a.data, the cipher and
+		//! compression below only transform the copy sent
+		byts, err := ioutil.ReadAll(body)
+		if err != nil {
+			a.Error = err
+			return nil, err
+		}
+		a.data = bytes.NewReader(byts)
+		body, length = bytes.NewReader(byts), len(byts)
 	}
 
-	//! cipher
-	if a.cipher != nil {
-		byts, err := ioutil.ReadAll(a.data)
+	//! cipher, the body must be encrypted before the request captures it
+	ciphered := false
+	if a.cipher != nil && body != nil {
+		byts, err := ioutil.ReadAll(body)
 		if err != nil {
+			a.Error = err
 			return nil, err
 		}
 		enbyts, err := a.cipher.Encrypt(byts)
 		if err != nil {
+			a.Error = err
 			return nil, err
 		}
-		a.headerIn.Set("X-CIPHER-ENCODED", "true")
-		a.data = bytes.NewBuffer(enbyts)
-		a.length = len(enbyts)
+		body, length = bytes.NewReader(enbyts), len(enbyts)
+		streaming = false
+		ciphered = true
 	}
 
-	var req *http.Request
-	req, err := http.NewRequest(a.m, a.u.String(), a.data)
+	//! compression wraps whatever the cipher produced
+	compressed := false
+	if a.compress != "" && body != nil {
+		if streaming {
+			body = compressStream(a.compress, body)
+			compressed = true
+		} else {
+			byts, err := ioutil.ReadAll(body)
+			if err != nil {
+				a.Error = err
+				return nil, err
+			}
+			if len(byts) > 0 {
+				if byts, err = compressBytes(a.compress, byts); err != nil {
+					a.Error = err
+					return nil, err
+				}
+				compressed = true
+			}
+			body, length = bytes.NewReader(byts), len(byts)
+		}
+	}
+
+	req, err = http.NewRequestWithContext(ctx, a.m, a.u.String(), body)
 	if err != nil {
 		a.Error = err
 		return nil, err
 	}
-	req = req.WithContext(ctx)
-	if a.reqProcessor != nil {
-		r, finish, err := a.reqProcessor(req)
-		if err != nil {
-			a.Error = err
-			return nil, err
-		}
-		if finish != nil {
-			defer finish()
-		}
-		req = r
+
+	//! content length, streams have none and are sent chunked
+	if body != nil {
+		req.ContentLength = int64(length)
+	}
+
+	//! upload progress
+	if a.uploadProgress != nil {
+		trackUpload(req, a.uploadProgress)
 	}
 
 	//! headers
-	req.Header = a.headerIn
-	req.Header.Set("Content-Type", content_type)
+	req.Header = a.headerIn.Clone()
+	if body != nil {
+		req.Header.Set("Content-Type", content_type)
+	}
+	if ciphered {
+		req.Header.Set(CIPHER_HEADER, "true")
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", a.compress)
+	}
+	for k, vs := range a.defaultHeaders {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = append([]string(nil), vs...)
+		}
+	}
+	if accept, ok := ctx.Value(acceptKey{}).(string); ok && req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", accept)
+	}
+	for _, propagator := range a.propagators {
+		propagator.Inject(ctx, req.Header)
+	}
+	if a.requestIDHeader != "" {
+		id := req.Header.Get(a.requestIDHeader)
+		if id == "" {
+			if id, err = newUUID(); err != nil {
+				a.Error = err
+				return nil, err
+			}
+			req.Header.Set(a.requestIDHeader, id)
+		}
+		a.requestID = id
+	}
 
 	//! query
 	q := req.URL.Query()
@@ -418,6 +1117,14 @@ func (a *Agent) Do(ctx context.Context) (*http.Response, error) {
 	}
 	req.URL.RawQuery = q.Encode()
 
+	if a.urlProcessor != nil {
+		if err := a.urlProcessor(req.URL); err != nil {
+			a.Error = err
+			return nil, err
+		}
+		req.Host = req.URL.Host
+	}
+
 	//! basic auth
 	if a.u.User != nil {
 		if password, ok := a.u.User.Password(); ok {
@@ -430,26 +1137,110 @@ func (a *Agent) Do(ctx context.Context) (*http.Response, error) {
 		req.AddCookie(cookie)
 	}
 
+	//! signing needs the final url and body
+	if a.signer != nil {
+		if err := a.signer.sign(req); err != nil {
+			a.Error = err
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+func (a *Agent) Do(ctx context.Context) (*http.Response, error) {
+	a.fromCache = false
+
+	//! timeout
+	cancel := context.CancelFunc(func() {})
+	if a.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+	}
+
+	//! trace
+	if a.tracer != nil {
+		ctx = a.tracer.context(ctx)
+	}
+
+	req, err := a.Request(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	//! oauth2 bearer token, fetched on send only so Request and Curl stay offline
+	if a.oauth2 != nil {
+		token, err := a.oauth2.token(ctx, a.client)
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			cancel()
+			a.Error = err
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	//! request processor
+	if a.reqProcessor != nil {
+		r, finish, err := a.reqProcessor(req)
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			cancel()
+			a.Error = err
+			return nil, err
+		}
+		if finish != nil {
+			defer finish()
+		}
+		req = r
+	}
+
 	//! do
 	if a.debug {
 		dump, _ := httputil.DumpRequest(req, true)
-		log.Printf("api request\n-------------------------------\n%s\n", string(dump))
+		a.debugDump("api request", dump)
+	}
+
+	resp, err := a.send(req)
+	if err != nil {
+		cancel()
+		if a.timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("api: request timeout after %s: %w", a.timeout, err)
+		}
+		return nil, err
 	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	if a.tracer != nil {
+		a.tracer.done()
+		resp.Body = &traceBody{ReadCloser: resp.Body, tracer: a.tracer}
+	}
+	a.headerOut = resp.Header
 
-	resp, err := a.client.Do(req)
-	if resp != nil {
-		a.headerOut = resp.Header
+	//! content encoding
+	if err := decompress(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	//! body limit
+	if a.maxBodyBytes > 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, limit: a.maxBodyBytes, remaining: a.maxBodyBytes}
 	}
 
 	if a.debug {
 		dump, _ := httputil.DumpResponse(resp, true)
-		log.Printf("api response\n-------------------------------\n%s\n", string(dump))
+		a.debugDump("api response", dump)
 	}
 
 	//! cipher
 	if a.cipher != nil {
-		if strings.ToLower(resp.Header.Get("X-CIPHER-ENCODED")) == "true" {
+		if strings.ToLower(resp.Header.Get(CIPHER_HEADER)) == "true" {
 			enbyts, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
 			if err != nil {
 				return nil, err
 			}
@@ -457,17 +1248,97 @@ func (a *Agent) Do(ctx context.Context) (*http.Response, error) {
 			if err != nil {
 				return nil, err
 			}
-			resp.Header.Del("X-CIPHER-ENCODED")
+			resp.Header.Del(CIPHER_HEADER)
 			resp.Body = ioutil.NopCloser(bytes.NewBuffer(debyts))
 			resp.ContentLength = int64(len(debyts))
 		}
 	}
 
+	//! charset
+	a.transcode(resp)
+
+	//! tee
+	if a.tee != nil {
+		resp.Body = &teeBody{ReadCloser: resp.Body, r: io.TeeReader(resp.Body, a.tee), w: a.tee}
+	}
+
 	//response processor
-	if a.respProcessor != nil && err == nil {
-		return a.respProcessor(resp)
+	if a.respProcessor != nil {
+		processed, err := a.respProcessor(resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return processed, nil
+	}
+	return resp, nil
+}
+
+// ErrBodyTooLarge is returned while reading a response body longer than
+// the limit set by MaxBodyBytes.
+var ErrBodyTooLarge = errors.New("api: response body exceeds limit")
+
+// MaxBodyBytes limits how much of a response body is read, reading past n
+// bytes fails with ErrBodyTooLarge.
+func (a *Agent) MaxBodyBytes(n int64) *Agent {
+	a.maxBodyBytes = n
+	return a
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, fmt.Errorf("%w of %d bytes", ErrBodyTooLarge, b.limit)
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n - 1, fmt.Errorf("%w of %d bytes", ErrBodyTooLarge, b.limit)
+	}
+	return n, err
+}
+
+// cancelBody releases the request context once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func isSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// ExpectStatus makes the response methods accept exactly the given status
+// codes, instead of any 2xx, and return an APIError for any other one.
+func (a *Agent) ExpectStatus(codes ...int) *Agent {
+	a.expect = codes
+	return a
+}
+
+func (a *Agent) expected(code int) bool {
+	if len(a.expect) == 0 {
+		return isSuccess(code)
+	}
+	for _, c := range a.expect {
+		if c == code {
+			return true
+		}
 	}
-	return resp, err
+	return false
 }
 
 func (a *Agent) ContextStatus(ctx context.Context) (int, string, error) {
@@ -476,48 +1347,143 @@ func (a *Agent) ContextStatus(ctx context.Context) (int, string, error) {
 		a.Error = err
 		return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), err
 	}
+	drain(resp)
 	return resp.StatusCode, resp.Status, nil
 }
 
+// Discard sends the request and reads the response body to the end, so the
+// connection can be reused, returning only the status code.
+func (a *Agent) Discard() (int, error) {
+	return a.ContextDiscard(a.context())
+}
+
+func (a *Agent) ContextDiscard(ctx context.Context) (int, error) {
+	code, _, err := a.ContextStatus(ctx)
+	return code, err
+}
+
+// drain reads the rest of the body before closing it, so the connection
+// goes back to the pool.
+func drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
 func (a *Agent) Status() (int, string, error) {
-	return a.ContextStatus(context.TODO())
+	return a.ContextStatus(a.context())
 }
 
-func (a *Agent) Bytes() (int, []byte, error) {
-	return a.ContextBytes(context.TODO())
+// Exists probes the resource with a HEAD request sent by a clone, leaving
+// the agent as configured. It reports true for an expected status, 2xx by
+// default, false for 404 and an error for any other status.
+func (a *Agent) Exists() (bool, error) {
+	return a.ContextExists(a.context())
 }
 
-func (a *Agent) ContextBytes(ctx context.Context) (int, []byte, error) {
+func (a *Agent) ContextExists(ctx context.Context) (bool, error) {
+	c := a.Clone().Method(HEAD)
+	resp, err := c.Do(ctx)
+	if err != nil {
+		a.Error = err
+		return false, err
+	}
+	defer drain(resp)
+	a.headerOut = resp.Header
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if !c.expected(resp.StatusCode) {
+		a.Error = c.newAPIError(resp)
+		return false, a.Error
+	}
+	return true, nil
+}
+
+// ContentLength probes the size of the resource with a HEAD request sent by
+// a clone, leaving the agent as configured. It returns -1 when the server
+// does not send a Content-Length.
+func (a *Agent) ContentLength() (int64, error) {
+	return a.ContextContentLength(a.context())
+}
+
+func (a *Agent) ContextContentLength(ctx context.Context) (int64, error) {
+	c := a.Clone().Method(HEAD)
+	resp, err := c.Do(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer drain(resp)
+
+	if !c.expected(resp.StatusCode) {
+		return -1, c.newAPIError(resp)
+	}
+	length := resp.Header.Get("Content-Length")
+	if length == "" {
+		return -1, nil
+	}
+	return strconv.ParseInt(length, 10, 64)
+}
+
+// Response is a fully read response: status, headers and body in one value,
+// independent of the agent's state.
+type Response struct {
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+}
+
+// Response sends the request and reads the whole response, so the headers
+// do not have to be fetched from GetHeadOut afterwards.
+func (a *Agent) Response() (*Response, error) {
+	return a.ContextResponse(a.context())
+}
+
+func (a *Agent) ContextResponse(ctx context.Context) (*Response, error) {
 	resp, err := a.Do(ctx)
 	if err != nil {
 		a.Error = err
-		return http.StatusInternalServerError, []byte{}, err
+		return &Response{StatusCode: http.StatusInternalServerError, Body: []byte{}}, err
 	}
 	defer resp.Body.Close()
+	r := &Response{StatusCode: resp.StatusCode, Headers: resp.Header}
 
 	if a.debug {
 		dump, _ := httputil.DumpResponse(resp, true)
-		log.Printf("api response\n--------------------------------\n%s\n", string(dump))
+		a.debugDump("api response", dump)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			a.Error = err
-			return resp.StatusCode, nil, fmt.Errorf(resp.Status)
-		}
-		a.Error = fmt.Errorf(string(body))
-		return resp.StatusCode, nil, a.Error
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return r, a.Error
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		a.Error = err
-		return resp.StatusCode, nil, err
+		return r, err
+	}
+
+	if a.checksum != nil {
+		h := a.checksum.hash()
+		h.Write(body)
+		if err := a.checksum.verify(h); err != nil {
+			a.Error = err
+			return r, err
+		}
 	}
 
-	resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-	return resp.StatusCode, body, a.Error
+	r.Body = body
+	return r, a.Error
+}
+
+func (a *Agent) Bytes() (int, []byte, error) {
+	return a.ContextBytes(a.context())
+}
+
+func (a *Agent) ContextBytes(ctx context.Context) (int, []byte, error) {
+	r, err := a.ContextResponse(ctx)
+	return r.StatusCode, r.Body, err
 }
 
 func (a *Agent) ContextText(ctx context.Context) (int, string, error) {
@@ -525,65 +1491,88 @@ func (a *Agent) ContextText(ctx context.Context) (int, string, error) {
 	return code, string(bytes), err
 }
 func (a *Agent) Text() (int, string, error) {
-	code, bytes, err := a.ContextBytes(context.TODO())
+	code, bytes, err := a.ContextBytes(a.context())
 	return code, string(bytes), err
 }
 
 func (a *Agent) JSON(obj interface{}) (int, error) {
-	return a.ContextJSON(context.TODO(), obj)
+	return a.ContextJSON(a.context(), obj)
 }
 func (a *Agent) ContextJSON(ctx context.Context, obj interface{}) (int, error) {
-	resp, err := a.Do(ctx)
+	resp, err := a.Do(withAccept(ctx, "application/json"))
 	if err != nil {
 		a.Error = err
 		return http.StatusInternalServerError, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, err := ioutil.ReadAll(resp.Body)
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	//! decode bytes to json, an empty body leaves obj as is
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
+		rd, empty, err := skipEmpty(resp.Body)
+		if err == nil && !empty {
+			err = a.decodeJSON(rd, &obj)
+		}
 		if err != nil {
 			a.Error = err
-			return resp.StatusCode, fmt.Errorf(resp.Status)
+			return resp.StatusCode, err
 		}
-		a.Error = fmt.Errorf(resp.Status)
-		return resp.StatusCode, fmt.Errorf(string(body))
+	}
+	return resp.StatusCode, a.Error
+}
+
+// JSONError decodes a 2xx response body into success and any other
+// response body into failure. Non-2xx statuses are not reported as errors,
+// the status code tells which of the two was filled.
+func (a *Agent) JSONError(success, failure interface{}) (int, error) {
+	return a.ContextJSONError(a.context(), success, failure)
+}
+
+func (a *Agent) ContextJSONError(ctx context.Context, success, failure interface{}) (int, error) {
+	resp, err := a.Do(withAccept(ctx, "application/json"))
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+
+	obj := success
+	if !a.expected(resp.StatusCode) {
+		obj = failure
 	}
 
-	//! decode bytes to json
 	if obj != nil {
-		if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		if err := a.decodeJSON(resp.Body, obj); err != nil {
 			a.Error = err
 			return resp.StatusCode, err
 		}
 	}
-	return resp.StatusCode, a.Error
+	return resp.StatusCode, nil
 }
 
 func (a *Agent) JSONPB(obj proto.Message) (int, error) {
-	return a.ContextJSONPB(context.TODO(), obj)
+	return a.ContextJSONPB(a.context(), obj)
 }
 
 func (a *Agent) ContextJSONPB(ctx context.Context, obj proto.Message) (int, error) {
-	resp, err := a.Do(ctx)
+	resp, err := a.Do(withAccept(ctx, "application/json"))
 	if err != nil {
 		a.Error = err
 		return http.StatusInternalServerError, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			a.Error = err
-			return resp.StatusCode, fmt.Errorf(resp.Status)
-		}
-		a.Error = fmt.Errorf(resp.Status)
-		return resp.StatusCode, fmt.Errorf(string(body))
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
 	}
 
 	//! decode bytes to jsonpb
-	if obj != nil {
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
 		if err := jsonpb.Unmarshal(resp.Body, obj); err != nil {
 			a.Error = err
 			return resp.StatusCode, err
@@ -591,30 +1580,150 @@ func (a *Agent) ContextJSONPB(ctx context.Context, obj proto.Message) (int, erro
 	}
 	return resp.StatusCode, a.Error
 }
+func (a *Agent) Protobuf(obj proto.Message) (int, error) {
+	return a.ContextProtobuf(a.context(), obj)
+}
+
+func (a *Agent) ContextProtobuf(ctx context.Context, obj proto.Message) (int, error) {
+	resp, err := a.Do(withAccept(ctx, "application/x-protobuf"))
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	//! decode bytes to protobuf
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			a.Error = err
+			return resp.StatusCode, err
+		}
+		if err := proto.Unmarshal(body, obj); err != nil {
+			a.Error = err
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, a.Error
+}
+
 func (a *Agent) XML(obj interface{}) (int, error) {
-	return a.ContextXML(context.TODO(), obj)
+	return a.ContextXML(a.context(), obj)
 }
 func (a *Agent) ContextXML(ctx context.Context, obj interface{}) (int, error) {
-	resp, err := a.Do(ctx)
+	resp, err := a.Do(withAccept(ctx, "application/xml"))
 	if err != nil {
 		a.Error = err
 		return http.StatusInternalServerError, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, err := ioutil.ReadAll(resp.Body)
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	//! decode bytes to xml, an empty body leaves obj as is
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
+		rd, empty, err := skipEmpty(resp.Body)
+		if err == nil && !empty {
+			err = xml.NewDecoder(rd).Decode(&obj)
+		}
 		if err != nil {
 			a.Error = err
-			return resp.StatusCode, fmt.Errorf(resp.Status)
+			return resp.StatusCode, err
 		}
-		a.Error = fmt.Errorf(resp.Status)
-		return resp.StatusCode, fmt.Errorf(string(body))
 	}
 
-	//! decode bytes to json
-	if obj != nil {
-		if err := xml.NewDecoder(resp.Body).Decode(&obj); err != nil {
+	return resp.StatusCode, a.Error
+}
+
+func (a *Agent) YAML(obj interface{}) (int, error) {
+	return a.ContextYAML(a.context(), obj)
+}
+func (a *Agent) ContextYAML(ctx context.Context, obj interface{}) (int, error) {
+	resp, err := a.Do(withAccept(ctx, "application/yaml"))
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	//! decode bytes to yaml
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
+		if err := yaml.NewDecoder(resp.Body).Decode(obj); err != nil {
+			a.Error = err
+			return resp.StatusCode, err
+		}
+	}
+
+	return resp.StatusCode, a.Error
+}
+
+func (a *Agent) Msgpack(obj interface{}) (int, error) {
+	return a.ContextMsgpack(a.context(), obj)
+}
+func (a *Agent) ContextMsgpack(ctx context.Context, obj interface{}) (int, error) {
+	resp, err := a.Do(withAccept(ctx, "application/msgpack"))
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	//! decode bytes to msgpack
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
+		if err := msgpack.NewDecoder(resp.Body).Decode(obj); err != nil {
+			a.Error = err
+			return resp.StatusCode, err
+		}
+	}
+
+	return resp.StatusCode, a.Error
+}
+
+func (a *Agent) CBORData(obj interface{}) *Agent {
+	data, err := cbor.Marshal(obj)
+	a.data = bytes.NewBuffer(data)
+	a.length = len(data)
+	a.Error = dataError("CBORData", obj, err)
+	a.t = "cbor"
+	return a
+}
+func (a *Agent) CBOR(obj interface{}) (int, error) {
+	return a.ContextCBOR(a.context(), obj)
+}
+func (a *Agent) ContextCBOR(ctx context.Context, obj interface{}) (int, error) {
+	resp, err := a.Do(withAccept(ctx, "application/cbor"))
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	//! decode bytes to cbor
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
+		if err := cbor.NewDecoder(resp.Body).Decode(obj); err != nil {
 			a.Error = err
 			return resp.StatusCode, err
 		}
@@ -631,6 +1740,10 @@ func (a *Agent) GetHeadOut() http.Header {
 	return a.headerOut
 }
 
+// ClearError resets the sticky Error of the agent. Any error, from a builder
+// method such as JSONData or from a failed request, makes later calls return
+// it without sending anything; clear it once the cause is fixed to reuse the
+// agent, setting the body again if it was consumed.
 func (a *Agent) ClearError() *Agent {
 	a.Error = nil
 	return a
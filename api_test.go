@@ -1,12 +1,32 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
 )
 
 func TestGetText(t *testing.T) {
@@ -67,3 +87,1486 @@ func TestProcessor(t *testing.T) {
 		t.Errorf("error : %v", err)
 	}
 }
+
+func TestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, _, err := Get(srv.URL).Timeout(100 * time.Millisecond).Bytes()
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout not honored, took %s", elapsed)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, _, err := Get(srv.URL).Context(ctx).Bytes()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancel not honored, took %s", elapsed)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var auth string
+	capture := func(req *http.Request) (*http.Request, RequestProcessorDeferHandler, error) {
+		auth = req.Header.Get("Authorization")
+		return req, nil, nil
+	}
+
+	agent := Get(srv.URL).RequestProcessor(capture)
+	if _, _, err := agent.BasicAuthSet("user", "pass").BearerToken("tok").Status(); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer tok" {
+		t.Errorf("got Authorization %q, want %q", auth, "Bearer tok")
+	}
+
+	agent = Get(srv.URL).RequestProcessor(capture)
+	if _, _, err := agent.BearerToken("tok").BasicAuthSet("user", "pass").Status(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(auth, "Basic ") {
+		t.Errorf("got Authorization %q, want basic auth", auth)
+	}
+
+	agent = Get(srv.URL).RequestProcessor(capture)
+	if _, _, err := agent.BearerToken("tok").BearerTokenDel().Status(); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "" {
+		t.Errorf("got Authorization %q, want none", auth)
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		case "/me":
+			session, err := r.Cookie("session")
+			if err != nil || session.Value != "abc" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			extra, err := r.Cookie("extra")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(extra.Value))
+		}
+	}))
+	defer srv.Close()
+
+	jar := NewCookieJar()
+	if code, _, err := Post(srv.URL).URI("/login").CookieJar(jar).Status(); err != nil || code != http.StatusOK {
+		t.Fatalf("login failed: %d, %v", code, err)
+	}
+
+	code, text, err := Get(srv.URL).URI("/me").CookieJar(jar).
+		CookiesAdd(&http.Cookie{Name: "extra", Value: "manual"}).Text()
+	if err != nil {
+		t.Fatalf("me failed: %d, %v", code, err)
+	}
+	if text != "manual" {
+		t.Errorf("got %q, want %q", text, "manual")
+	}
+	if http.DefaultClient.Jar != nil {
+		t.Error("CookieJar must not modify http.DefaultClient")
+	}
+}
+
+func TestJSONError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"code":42,"message":"invalid name"}`))
+			return
+		}
+		w.Write([]byte(`{"id":7,"name":"api"}`))
+	}))
+	defer srv.Close()
+
+	type Item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	type Failure struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	var item Item
+	var failure Failure
+	code, err := Get(srv.URL).JSONError(&item, &failure)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("JSONError failed: %d, %v", code, err)
+	}
+	if item.ID != 7 || item.Name != "api" || failure != (Failure{}) {
+		t.Errorf("got item %+v, failure %+v", item, failure)
+	}
+
+	item, failure = Item{}, Failure{}
+	code, err = Get(srv.URL).QuerySet("fail", "1").JSONError(&item, &failure)
+	if err != nil || code != http.StatusUnprocessableEntity {
+		t.Fatalf("JSONError failed: %d, %v", code, err)
+	}
+	if failure.Code != 42 || failure.Message != "invalid name" || item != (Item{}) {
+		t.Errorf("got item %+v, failure %+v", item, failure)
+	}
+}
+
+func TestSuccessStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":1}`))
+		case "/accepted":
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`<item><id>2</id></item>`))
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	type Item struct {
+		ID int `json:"id" xml:"id"`
+	}
+
+	var item Item
+	if code, err := Post(srv.URL).URI("/created").JSON(&item); err != nil || code != http.StatusCreated || item.ID != 1 {
+		t.Errorf("201: got %d, %+v, %v", code, item, err)
+	}
+	if code, err := Post(srv.URL).URI("/accepted").XML(&item); err != nil || code != http.StatusAccepted || item.ID != 2 {
+		t.Errorf("202: got %d, %+v, %v", code, item, err)
+	}
+	if code, body, err := Post(srv.URL).URI("/accepted").Bytes(); err != nil || code != http.StatusAccepted || len(body) == 0 {
+		t.Errorf("202: got %d, %q, %v", code, body, err)
+	}
+	if code, err := URL(srv.URL).Method(DELETE).URI("/empty").JSON(&item); err != nil || code != http.StatusNoContent {
+		t.Errorf("204 JSON: got %d, %v", code, err)
+	}
+	if code, err := URL(srv.URL).Method(DELETE).URI("/empty").XML(&item); err != nil || code != http.StatusNoContent {
+		t.Errorf("204 XML: got %d, %v", code, err)
+	}
+}
+
+func TestURITemplate(t *testing.T) {
+	agent := URL("http://localhost/v1/").URITemplate("/users/{id}/posts/{postID}", map[string]string{
+		"id":     "a b/c",
+		"postID": "42?x=%",
+	})
+	if agent.Error != nil {
+		t.Fatal(agent.Error)
+	}
+	want := "http://localhost/v1/users/a%20b%2Fc/posts/42%3Fx=%25"
+	if got := agent.u.String(); got != want {
+		t.Errorf("got url %q, want %q", got, want)
+	}
+
+	agent = URL("http://localhost").URITemplate("/users/{id}", map[string]string{})
+	if agent.Error == nil {
+		t.Error("expected missing parameter error")
+	}
+}
+
+func TestClone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s/%s/%s", r.Header.Get("X-Base"), r.Header.Get("X-ID"), r.URL.Query().Get("id"))
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).HeadSet("X-Base", "base").QuerySet("base", "1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprint(i)
+			code, text, err := base.Clone().HeadSet("X-ID", id).QuerySet("id", id).URI("/" + id).Text()
+			if err != nil {
+				t.Errorf("clone %d: %d, %v", i, code, err)
+				return
+			}
+			if want := "base/" + id + "/" + id; text != want {
+				t.Errorf("clone %d: got %q, want %q", i, text, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if base.GetHeadIn().Get("X-ID") != "" || base.QueryGet().Get("id") != "" || base.u.Path != "" {
+		t.Error("clones modified the template agent")
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":"` + strings.Repeat("x", 1024) + `"}`))
+	}))
+	defer srv.Close()
+
+	if _, _, err := Get(srv.URL).MaxBodyBytes(100).Bytes(); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Bytes: expected ErrBodyTooLarge, got %v", err)
+	}
+
+	var obj map[string]string
+	if _, err := Get(srv.URL).MaxBodyBytes(100).JSON(&obj); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("JSON: expected ErrBodyTooLarge, got %v", err)
+	}
+
+	if _, body, err := Get(srv.URL).MaxBodyBytes(2048).Bytes(); err != nil || len(body) != 1035 {
+		t.Errorf("within limit: got %d bytes, %v", len(body), err)
+	}
+	if _, body, err := Get(srv.URL).MaxBodyBytes(1035).Bytes(); err != nil || len(body) != 1035 {
+		t.Errorf("exact limit: got %d bytes, %v", len(body), err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.Header.Get("Content-Type"))
+	}))
+	defer srv.Close()
+
+	_, text, err := Put(srv.URL).FormData(nil).ContentType("xml").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "PUT application/xml" {
+		t.Errorf("got %q, want %q", text, "PUT application/xml")
+	}
+
+	_, text, err = Post(srv.URL).JSONData(1).ContentType("application/vnd.api+json").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "POST application/vnd.api+json" {
+		t.Errorf("got %q, want %q", text, "POST application/vnd.api+json")
+	}
+
+	_, text, err = Get(srv.URL).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "GET " {
+		t.Errorf("got %q, want no content type on a bodiless request", text)
+	}
+}
+
+type xorCipher byte
+
+func (c xorCipher) Encrypt(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ byte(c)
+	}
+	return out, nil
+}
+
+func (c xorCipher) Decrypt(data []byte) ([]byte, error) {
+	return c.Encrypt(data)
+}
+
+func TestCipher(t *testing.T) {
+	cipher := xorCipher(0x5a)
+	plain := `{"secret":"value"}`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(CIPHER_HEADER) != "true" {
+			t.Error("request is missing the cipher header")
+		}
+		if string(body) == plain || r.ContentLength != int64(len(plain)) {
+			t.Errorf("server received %q with length %d", body, r.ContentLength)
+		}
+		decoded, _ := cipher.Decrypt(body)
+		if string(decoded) != plain {
+			t.Errorf("server decrypted %q", decoded)
+		}
+		reply, _ := cipher.Encrypt([]byte("reply:" + string(decoded)))
+		w.Header().Set(CIPHER_HEADER, "true")
+		w.Write(reply)
+	}))
+	defer srv.Close()
+
+	code, text, err := Post(srv.URL).SetCipher(cipher).JSONData(map[string]string{"secret": "value"}).Text()
+	if err != nil {
+		t.Fatalf("cipher request failed: %d, %v", code, err)
+	}
+	if text != "reply:"+plain {
+		t.Errorf("got %q", text)
+	}
+
+	//! building the request first must not encrypt the stored body twice
+	agent := Post(srv.URL).SetCipher(cipher).JSONData(map[string]string{"secret": "value"})
+	if _, err := agent.Request(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Curl(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, text, err := agent.Text(); err != nil || text != "reply:"+plain {
+			t.Errorf("send %d: %q, %v", i, text, err)
+		}
+	}
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("User-Agent"), r.Header.Get("Accept"))
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).DefaultHeaders(http.Header{
+		"User-Agent": {"base-agent"},
+		"Accept":     {"application/json"},
+	})
+
+	_, text, err := base.Clone().HeadSet("User-Agent", "custom").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "custom|application/json" {
+		t.Errorf("got %q", text)
+	}
+
+	_, text, err = base.Clone().Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "base-agent|application/json" {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	agent := Post("http://localhost:8080/v1/").URI("/items").QuerySet("q", "x").
+		HeadSet("X-Trace", "1").BasicAuthSet("user", "pass").
+		CookiesAdd(&http.Cookie{Name: "session", Value: "abc"}).
+		JSONData(map[string]int{"a": 1})
+
+	req, err := agent.Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.String(); got != "http://localhost:8080/v1/items?q=x" {
+		t.Errorf("got url %q", got)
+	}
+	if req.Method != POST || req.Header.Get("Content-Type") != "application/json" || req.Header.Get("X-Trace") != "1" {
+		t.Errorf("got method %s, headers %v", req.Method, req.Header)
+	}
+	if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("got basic auth %q %q", user, pass)
+	}
+	if c, err := req.Cookie("session"); err != nil || c.Value != "abc" {
+		t.Errorf("got cookie %v, %v", c, err)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != `{"a":1}` || req.ContentLength != int64(len(body)) {
+		t.Errorf("got body %q, length %d", body, req.ContentLength)
+	}
+
+	//! the agent body is still available to send
+	req, err = agent.Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(req.Body)
+	if string(body) != `{"a":1}` || req.ContentLength != int64(len(body)) {
+		t.Errorf("rebuilt body %q, length %d", body, req.ContentLength)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	type Container struct {
+		Name  string            `yaml:"name"`
+		Ports []int             `yaml:"ports"`
+		Env   map[string]string `yaml:"env"`
+	}
+	type Pod struct {
+		Kind       string      `yaml:"kind"`
+		Containers []Container `yaml:"containers"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/yaml" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	in := Pod{
+		Kind: "Pod",
+		Containers: []Container{
+			{Name: "web", Ports: []int{80, 443}, Env: map[string]string{"MODE": "prod"}},
+		},
+	}
+	var out Pod
+	code, err := Post(srv.URL).YAMLData(in).YAML(&out)
+	if err != nil {
+		t.Fatalf("YAML round trip failed: %d, %v", code, err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestMsgpack(t *testing.T) {
+	type Metric struct {
+		Name   string             `msgpack:"name"`
+		Tags   map[string]string  `msgpack:"tags"`
+		Values []float64          `msgpack:"values"`
+		Limits map[string]float64 `msgpack:"limits"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/msgpack" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	in := Metric{
+		Name:   "latency",
+		Tags:   map[string]string{"host": "a", "dc": "b"},
+		Values: []float64{1.5, 2.25, 3},
+		Limits: map[string]float64{"p99": 250},
+	}
+	var out Metric
+	code, err := Post(srv.URL).MsgpackData(in).Msgpack(&out)
+	if err != nil {
+		t.Fatalf("msgpack round trip failed: %d, %v", code, err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	type Reading struct {
+		Sensor string            `cbor:"sensor"`
+		Raw    []byte            `cbor:"raw"`
+		Values []float64         `cbor:"values"`
+		Labels map[string]string `cbor:"labels"`
+	}
+	type Batch struct {
+		Device   string    `cbor:"device"`
+		Readings []Reading `cbor:"readings"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/cbor" || r.Header.Get("Accept") != "application/cbor" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/cbor")
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	in := Batch{
+		Device: "edge-1",
+		Readings: []Reading{
+			{Sensor: "temp", Raw: []byte{0x00, 0xff, 0x10}, Values: []float64{21.5, 22}, Labels: map[string]string{"unit": "C"}},
+		},
+	}
+	var out Batch
+	code, err := Post(srv.URL).CBORData(in).CBOR(&out)
+	if err != nil {
+		t.Fatalf("CBOR round trip failed: %d, %v", code, err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+
+	if _, err := Post(srv.URL).CBORData(make(chan int)).CBOR(&out); err == nil {
+		t.Error("expected marshal error")
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	in := &timestamp.Timestamp{Seconds: 1700000000, Nanos: 42}
+	out := &timestamp.Timestamp{}
+	code, err := Post(srv.URL).ProtobufData(in).Protobuf(out)
+	if err != nil {
+		t.Fatalf("protobuf round trip failed: %d, %v", code, err)
+	}
+	if !proto.Equal(in, out) {
+		t.Errorf("got %v, want %v", out, in)
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+	var hops int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/loop":
+			atomic.AddInt32(&hops, 1)
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.Write([]byte("target"))
+		}
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).URI("/moved").FollowRedirects(-1)
+	code, _, err := agent.Status()
+	if err != nil || code != http.StatusFound {
+		t.Fatalf("got %d, %v, want 302", code, err)
+	}
+	if loc := agent.GetHeadOut().Get("Location"); loc != "/target" {
+		t.Errorf("got Location %q", loc)
+	}
+
+	if _, text, err := Get(srv.URL).URI("/moved").FollowRedirects(3).Text(); err != nil || text != "target" {
+		t.Errorf("got %q, %v", text, err)
+	}
+
+	_, _, err = Get(srv.URL).URI("/loop").FollowRedirects(3).Status()
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("expected ErrTooManyRedirects, got %v", err)
+	}
+	if hops != 4 {
+		t.Errorf("server saw %d requests, want 4", hops)
+	}
+	if http.DefaultClient.CheckRedirect != nil {
+		t.Error("FollowRedirects must not modify http.DefaultClient")
+	}
+}
+
+func TestSetClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("visited"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "visited", Value: "1"})
+			w.Write([]byte("first"))
+			return
+		}
+		w.Write([]byte("again"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Jar: NewCookieJar(), Timeout: time.Second}
+	for _, want := range []string{"first", "again", "again"} {
+		_, text, err := Get(srv.URL).SetClient(client).Text()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != want {
+			t.Errorf("got %q, want %q", text, want)
+		}
+	}
+}
+
+type closeCounter struct {
+	io.ReadCloser
+	closes *int32
+}
+
+func (c *closeCounter) Close() error {
+	atomic.AddInt32(c.closes, 1)
+	return c.ReadCloser.Close()
+}
+
+func TestBodyClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("failure"))
+		case "/garbage":
+			w.Write([]byte("<<not json or xml>>"))
+		default:
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer srv.Close()
+
+	var opens, closes int32
+	counter := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			if err == nil {
+				atomic.AddInt32(&opens, 1)
+				resp.Body = &closeCounter{ReadCloser: resp.Body, closes: &closes}
+			}
+			return resp, err
+		}
+	}
+
+	calls := map[string]func(a *Agent) error{
+		"Status": func(a *Agent) error { _, _, err := a.Status(); return err },
+		"Bytes":  func(a *Agent) error { _, _, err := a.Bytes(); return err },
+		"Text":   func(a *Agent) error { _, _, err := a.Text(); return err },
+		"JSON":   func(a *Agent) error { var v interface{}; _, err := a.JSON(&v); return err },
+		"XML":    func(a *Agent) error { var v struct{}; _, err := a.XML(&v); return err },
+		"YAML":   func(a *Agent) error { var v interface{}; _, err := a.YAML(&v); return err },
+		"JSONError": func(a *Agent) error {
+			var v, f interface{}
+			_, err := a.JSONError(&v, &f)
+			return err
+		},
+		"Processor": func(a *Agent) error {
+			_, err := a.ResponseProcessor(func(*http.Response) (*http.Response, error) {
+				return nil, errors.New("rejected")
+			}).Do(context.Background())
+			return err
+		},
+	}
+	for name, call := range calls {
+		for _, path := range []string{"/ok", "/fail", "/garbage"} {
+			call(Get(srv.URL).URI(path).Use(counter))
+			if opens != closes {
+				t.Errorf("%s %s: opened %d bodies, closed %d", name, path, opens, closes)
+			}
+			opens, closes = 0, 0
+		}
+	}
+}
+
+func TestJSONDataIndent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	v := map[string]interface{}{"name": "<api>", "tags": []string{"a"}}
+	_, text, err := Post(srv.URL).JSONDataIndent(v, "", "  ").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"name\": \"\\u003capi\\u003e\",\n  \"tags\": [\n    \"a\"\n  ]\n}"
+	if text != want {
+		t.Errorf("got %s, want %s", text, want)
+	}
+
+	_, text, err = Post(srv.URL).JSONDataIndent(v, "", "\t", true).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n\t\"name\": \"<api>\",\n\t\"tags\": [\n\t\t\"a\"\n\t]\n}"; text != want {
+		t.Errorf("got %s, want %s", text, want)
+	}
+}
+
+func TestJSONHelpers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]interface{}
+		if r.Method == POST {
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"method": r.Method, "in": in})
+	}))
+	defer srv.Close()
+
+	type Reply struct {
+		Method string         `json:"method"`
+		In     map[string]int `json:"in"`
+	}
+
+	var reply Reply
+	code, err := GetJSON(context.Background(), srv.URL, &reply)
+	if err != nil || code != http.StatusOK || reply.Method != GET {
+		t.Errorf("GetJSON: got %d, %+v, %v", code, reply, err)
+	}
+
+	reply = Reply{}
+	code, err = PostJSON(context.Background(), srv.URL, map[string]int{"n": 5}, &reply)
+	if err != nil || code != http.StatusOK || reply.Method != POST || reply.In["n"] != 5 {
+		t.Errorf("PostJSON: got %d, %+v, %v", code, reply, err)
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"id":1,"echo":` + string(body) + `}`))
+	}))
+	defer srv.Close()
+
+	marshal := func(v interface{}) ([]byte, error) {
+		return json.MarshalIndent(v, "", " ")
+	}
+	strict := func(data []byte, v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+
+	type Item struct {
+		ID int `json:"id"`
+	}
+
+	var item Item
+	_, err := Post(srv.URL).JSONCodec(marshal, strict).JSONData(map[string]int{"n": 1}).JSON(&item)
+	if err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+
+	var echo struct {
+		ID   int             `json:"id"`
+		Echo json.RawMessage `json:"echo"`
+	}
+	_, err = Post(srv.URL).JSONCodec(marshal, strict).JSONData(map[string]int{"n": 1}).JSON(&echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(echo.Echo) != "{\n \"n\": 1\n}" {
+		t.Errorf("server received %q, want the custom marshaled body", echo.Echo)
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1,"nmae":"typo"}`))
+	}))
+	defer srv.Close()
+
+	type Item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	var item Item
+	if _, err := Get(srv.URL).JSON(&item); err != nil || item.ID != 1 {
+		t.Errorf("lenient decode: got %+v, %v", item, err)
+	}
+	if _, err := Get(srv.URL).StrictJSON(true).JSON(&item); err == nil {
+		t.Error("strict decode accepted an unknown field")
+	}
+}
+
+func TestUseNumber(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1234567890123456789}`))
+	}))
+	defer srv.Close()
+
+	out := map[string]interface{}{}
+	if _, err := Get(srv.URL).JSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out["id"].(float64); !ok {
+		t.Errorf("default decode: got %T", out["id"])
+	}
+
+	out = map[string]interface{}{}
+	if _, err := Get(srv.URL).UseNumber(true).JSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := out["id"].(json.Number); !ok || n.String() != "1234567890123456789" {
+		t.Errorf("got %T %v", out["id"], out["id"])
+	}
+}
+
+func TestAccept(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accept", r.Header.Get("Accept"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	decoders := map[string]func(a *Agent){
+		"application/json":       func(a *Agent) { a.JSON(nil) },
+		"application/xml":        func(a *Agent) { a.XML(nil) },
+		"application/yaml":       func(a *Agent) { a.YAML(nil) },
+		"application/msgpack":    func(a *Agent) { a.Msgpack(nil) },
+		"application/x-protobuf": func(a *Agent) { a.Protobuf(nil) },
+	}
+	for want, decode := range decoders {
+		agent := Get(srv.URL)
+		decode(agent)
+		if got := agent.GetHeadOut().Get("X-Accept"); got != want {
+			t.Errorf("got Accept %q, want %q", got, want)
+		}
+
+		agent = Get(srv.URL).HeadSet("Accept", "text/plain")
+		decode(agent)
+		if got := agent.GetHeadOut().Get("X-Accept"); got != "text/plain" {
+			t.Errorf("user Accept overridden with %q", got)
+		}
+	}
+
+	agent := Get(srv.URL).Accept("xml")
+	agent.JSON(nil)
+	if got := agent.GetHeadOut().Get("X-Accept"); got != "application/xml" {
+		t.Errorf("got Accept %q, want application/xml", got)
+	}
+
+	agent = Get(srv.URL)
+	agent.Bytes()
+	if got := agent.GetHeadOut().Get("X-Accept"); got != "" {
+		t.Errorf("got Accept %q for Bytes, want none", got)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Path", r.URL.Path)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	resp, err := Get(srv.URL).URI("/hello").Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != "hello" || resp.Headers.Get("X-Request-Path") != "/hello" {
+		t.Errorf("got %d %q %v", resp.StatusCode, resp.Body, resp.Headers)
+	}
+
+	resp, err = Get(srv.URL).URI("/missing").Response()
+	if err == nil || resp.StatusCode != http.StatusNotFound || resp.Headers.Get("X-Request-Path") != "/missing" {
+		t.Errorf("got %d %v %v", resp.StatusCode, resp.Headers, err)
+	}
+}
+
+func TestClearError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	agent := Post(srv.URL).JSONData(make(chan int))
+	if _, _, err := agent.Text(); err == nil {
+		t.Fatal("expected marshal error")
+	}
+
+	agent = Post(srv.URL).QuerySet("fail", "1")
+	if _, _, err := agent.Text(); err == nil {
+		t.Fatal("expected status error")
+	}
+	agent.QueryDel("fail")
+	if _, _, err := agent.Text(); err == nil {
+		t.Fatal("expected sticky error before ClearError")
+	}
+
+	_, text, err := agent.ClearError().JSONData(map[string]int{"a": 1}).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != `{"a":1}` {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%d:%v:%s", r.ContentLength, r.TransferEncoding, body)
+	}))
+	defer srv.Close()
+
+	_, text, err := Post(srv.URL).JSONData(map[string]int{"a": 1}).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `7:[]:{"a":1}`; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	_, text, err = Post(srv.URL).Stream(strings.NewReader("streamed")).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-1:[chunked]:streamed"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestExists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != HEAD {
+			w.Write([]byte(r.Method + " body"))
+			return
+		}
+		switch r.URL.Path {
+		case "/moved":
+			w.WriteHeader(http.StatusNotModified)
+		case "/found":
+			w.Header().Set("Content-Length", "1024")
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	if ok, err := Get(srv.URL).URI("/found").Exists(); !ok || err != nil {
+		t.Errorf("found: %v, %v", ok, err)
+	}
+	if ok, err := Get(srv.URL).URI("/missing").Exists(); ok || err != nil {
+		t.Errorf("missing: %v, %v", ok, err)
+	}
+	if _, err := Get(srv.URL).URI("/broken").Exists(); err == nil {
+		t.Error("expected error for 500")
+	}
+	if ok, err := Get(srv.URL).URI("/moved").ExpectStatus(http.StatusNotModified).Exists(); !ok || err != nil {
+		t.Errorf("expected 304: %v, %v", ok, err)
+	}
+
+	//! the probe leaves the agent's method alone
+	agent := Get(srv.URL).URI("/found")
+	agent.Exists()
+	if _, text, err := agent.Text(); err != nil || text != "GET body" {
+		t.Errorf("after Exists: %q, %v", text, err)
+	}
+
+	code, _, err := Head(srv.URL).URI("/found").Status()
+	if code != http.StatusOK || err != nil {
+		t.Errorf("status: %d, %v", code, err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "42")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"error":"invalid name"}`))
+	}))
+	defer srv.Close()
+
+	calls := map[string]func(*Agent) error{
+		"Bytes": func(a *Agent) error { _, _, err := a.Bytes(); return err },
+		"JSON":  func(a *Agent) error { _, err := a.JSON(nil); return err },
+		"XML":   func(a *Agent) error { _, err := a.XML(nil); return err },
+	}
+	for name, call := range calls {
+		err := call(Get(srv.URL))
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("%s: got %T %v", name, err, err)
+		}
+		if apiErr.StatusCode != http.StatusUnprocessableEntity || string(apiErr.Body) != `{"error":"invalid name"}` ||
+			apiErr.Header.Get("X-Request-Id") != "42" {
+			t.Errorf("%s: got %+v", name, apiErr)
+		}
+		if err.Error() != `{"error":"invalid name"}` {
+			t.Errorf("%s: message %q", name, err.Error())
+		}
+	}
+}
+
+func TestBasicAuthHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		fmt.Fprintf(w, "%s:%s:%v", user, pass, ok)
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).BasicAuthHeader("user", "p@ss:word")
+	req, err := agent.Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.User != nil || strings.Contains(req.URL.String(), "user") {
+		t.Errorf("credentials leaked into url %q", req.URL)
+	}
+	_, text, err := agent.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "user:p@ss:word:true" {
+		t.Errorf("got %q", text)
+	}
+
+	_, text, _ = agent.BasicAuthDel().Text()
+	if text != "::false" {
+		t.Errorf("got %q after BasicAuthDel", text)
+	}
+}
+
+func TestBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Header.Get("Content-Type"), body)
+	}))
+	defer srv.Close()
+
+	type item struct {
+		XMLName xml.Name `json:"-" xml:"item" form:"-"`
+		Name    string   `json:"name" xml:"name" form:"name"`
+	}
+	v := item{Name: "api"}
+
+	cases := map[string]string{
+		"":                            `application/json {"name":"api"}`,
+		"json":                        `application/json {"name":"api"}`,
+		"xml":                         `application/xml <item><name>api</name></item>`,
+		"application/vnd.example+xml": `application/vnd.example+xml <item><name>api</name></item>`,
+		"form":                        `application/x-www-form-urlencoded name=api`,
+	}
+	for ct, want := range cases {
+		agent := Post(srv.URL)
+		if ct != "" {
+			agent.ContentType(ct)
+		}
+		_, text, err := agent.Body(v).Text()
+		if err != nil {
+			t.Fatalf("%q: %v", ct, err)
+		}
+		if text != want {
+			t.Errorf("%q: got %q, want %q", ct, text, want)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("Content-Type"), body)
+	}))
+	defer srv.Close()
+
+	_, text, err := Post(srv.URL).MergePatch(map[string]interface{}{"name": "api", "tag": nil}).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `PATCH application/merge-patch+json {"name":"api","tag":null}`; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	_, text, err = Post(srv.URL).JSONPatch([]PatchOp{
+		{Op: "replace", Path: "/name", Value: "api"},
+		{Op: "move", From: "/a", Path: "/b"},
+		{Op: "replace", Path: "/tag", Value: nil},
+		{Op: "test", Path: "/tag", Value: nil},
+		{Op: "remove", Path: "/c"},
+	}).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `PATCH application/json-patch+json [{"op":"replace","path":"/name","value":"api"},{"op":"move","path":"/b","from":"/a"},` +
+		`{"op":"replace","path":"/tag","value":null},{"op":"test","path":"/tag","value":null},{"op":"remove","path":"/c"}]`
+	if text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestPath(t *testing.T) {
+	cases := []struct {
+		agent *Agent
+		want  string
+	}{
+		{URL("http://localhost/v1/").Path("users", "42"), "http://localhost/v1/users/42"},
+		{URL("http://localhost/v1").Path("/users/", "/42"), "http://localhost/v1/users/42"},
+		{URL("http://localhost").Path("users/42", "files/"), "http://localhost/users/42/files/"},
+		{URL("http://localhost/v1").URI("/users").Path("a b", "x?y"), "http://localhost/v1/users/a%20b/x%3Fy"},
+		{URL("http://localhost").Path("a%2Fb", "100%"), "http://localhost/a%2Fb/100%25"},
+	}
+	for _, c := range cases {
+		req, err := c.agent.Request(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.URL.String(); got != c.want {
+			t.Errorf("got %q, want %q", got, c.want)
+		}
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 64<<10))
+	}))
+	var conns int32
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	for i := 0; i < 3; i++ {
+		if code, _, err := Get(srv.URL).SetClient(client).Status(); err != nil || code != http.StatusOK {
+			t.Fatalf("status: %d, %v", code, err)
+		}
+		if code, err := Get(srv.URL).SetClient(client).Discard(); err != nil || code != http.StatusOK {
+			t.Fatalf("discard: %d, %v", code, err)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("opened %d connections, want 1", n)
+	}
+}
+
+func TestRawData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %d %q", r.Header.Get("Content-Type"), r.ContentLength, body)
+	}))
+	defer srv.Close()
+
+	_, text, err := Post(srv.URL).RawData("application/vnd.custom; v=2", []byte("\x00\x01raw")).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `application/vnd.custom; v=2 5 "\x00\x01raw"`; text != want {
+		t.Errorf("got %s, want %s", text, want)
+	}
+}
+
+func TestErrorBodyLimit(t *testing.T) {
+	page := strings.Repeat("<p>error</p>", 10<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	var apiErr *APIError
+	_, _, err := Get(srv.URL).ErrorBodyLimit(16).Bytes()
+	if !errors.As(err, &apiErr) || string(apiErr.Body) != page[:16]+"…truncated" {
+		t.Errorf("got %v", err)
+	}
+
+	_, err = Get(srv.URL).JSON(nil)
+	if !errors.As(err, &apiErr) || len(apiErr.Body) != DefaultErrorBodyLimit+len("…truncated") {
+		t.Errorf("default limit: got %d bytes", len(apiErr.Body))
+	}
+
+	_, _, err = Get(srv.URL).ErrorBodyLimit(-1).Bytes()
+	if !errors.As(err, &apiErr) || string(apiErr.Body) != page {
+		t.Errorf("unlimited: got %d bytes", len(apiErr.Body))
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		switch r.URL.Path {
+		case "/sized":
+			w.Header().Set("Content-Length", "1048576")
+		case "/unknown":
+			w.Header().Set("Transfer-Encoding", "chunked")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).URI("/sized")
+	if n, err := agent.ContentLength(); err != nil || n != 1048576 {
+		t.Errorf("sized: %d, %v", n, err)
+	}
+	if agent.m != GET {
+		t.Errorf("method changed to %s", agent.m)
+	}
+	if n, err := Get(srv.URL).URI("/unknown").ContentLength(); err != nil || n != -1 {
+		t.Errorf("unknown: %d, %v", n, err)
+	}
+	if _, err := Get(srv.URL).URI("/missing").ContentLength(); err == nil {
+		t.Error("expected error for 404")
+	}
+}
+
+func TestExpectStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":1}`))
+		case "/ok":
+			w.Write([]byte(`{"id":2}`))
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"id":3}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom"))
+		}
+	}))
+	defer srv.Close()
+
+	var item struct {
+		ID int `json:"id"`
+	}
+	if code, err := Post(srv.URL).URI("/created").ExpectStatus(http.StatusCreated).JSON(&item); err != nil || code != http.StatusCreated || item.ID != 1 {
+		t.Errorf("created: %d, %+v, %v", code, item, err)
+	}
+
+	var apiErr *APIError
+	_, err := Post(srv.URL).URI("/ok").ExpectStatus(http.StatusCreated).JSON(&item)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusOK {
+		t.Errorf("unexpected 200: got %v", err)
+	}
+
+	if code, err := Get(srv.URL).URI("/gone").ExpectStatus(http.StatusOK, http.StatusGone).JSON(&item); err != nil || code != http.StatusGone || item.ID != 3 {
+		t.Errorf("allowed 410: %d, %+v, %v", code, item, err)
+	}
+
+	_, _, err = Get(srv.URL).URI("/boom").ExpectStatus(http.StatusOK).Bytes()
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || err.Error() != "boom" {
+		t.Errorf("disallowed 500: got %v", err)
+	}
+}
+
+func TestBodyOnGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.Header.Get("Content-Type") + " " + string(body)))
+	}))
+	defer srv.Close()
+
+	query := map[string]interface{}{"query": map[string]interface{}{"match_all": struct{}{}}}
+	_, text, err := Get(srv.URL).JSONData(query).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `GET application/json {"query":{"match_all":{}}}`; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	if _, _, err := Get(srv.URL).AllowBodyOnGet(false).JSONData(query).Text(); err == nil {
+		t.Error("expected error for a GET body")
+	}
+	if _, text, err := Get(srv.URL).AllowBodyOnGet(false).Text(); err != nil || text != "GET  " {
+		t.Errorf("GET without body: %q, %v", text, err)
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		file, _ := NewFileStream("file", "a.txt", strings.NewReader("data"))
+		if _, err := Get(srv.URL).AllowBodyOnGet(false).FileData(file).Request(context.Background()); err == nil {
+			t.Fatal("expected error for a GET multipart body")
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := runtime.NumGoroutine() - before; n > 2 {
+		t.Errorf("%d goroutines leaked", n)
+	}
+}
+
+func TestEmptyBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("body")))
+	}))
+	defer srv.Close()
+
+	for _, body := range []string{"", " \r\n\t "} {
+		var obj struct {
+			ID int `json:"id" xml:"id"`
+		}
+		if code, err := Get(srv.URL).QuerySet("body", body).JSON(&obj); err != nil || code != http.StatusOK {
+			t.Errorf("json %q: %d, %v", body, code, err)
+		}
+		if code, err := Get(srv.URL).QuerySet("body", body).XML(&obj); err != nil || code != http.StatusOK {
+			t.Errorf("xml %q: %d, %v", body, code, err)
+		}
+	}
+
+	var obj struct {
+		ID int `json:"id" xml:"id"`
+	}
+	if _, err := Get(srv.URL).QuerySet("body", ` {"id":7}`).JSON(&obj); err != nil || obj.ID != 7 {
+		t.Errorf("json with leading space: %+v, %v", obj, err)
+	}
+	if _, err := Get(srv.URL).QuerySet("body", " <obj><id>8</id></obj>").XML(&obj); err != nil || obj.ID != 8 {
+		t.Errorf("xml with leading space: %+v, %v", obj, err)
+	}
+	if _, err := Get(srv.URL).QuerySet("body", " {bad").JSON(&obj); err == nil {
+		t.Error("expected error for malformed json")
+	}
+	if _, err := Get(srv.URL).QuerySet("body", "<bad").XML(&obj); err == nil {
+		t.Error("expected error for malformed xml")
+	}
+}
+
+func TestURLProcessor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer srv.Close()
+
+	sign := func(u *url.URL) error {
+		q := u.Query()
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(u.Path + "?" + u.RawQuery))
+		q.Set("signature", hex.EncodeToString(mac.Sum(nil))[:8])
+		u.RawQuery = q.Encode()
+		return nil
+	}
+	_, text, err := Get(srv.URL).URI("/files").QuerySet("expires", "60").URLProcessor(sign).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("/files?expires=60"))
+	if want := "expires=60&signature=" + hex.EncodeToString(mac.Sum(nil))[:8]; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	abort := errors.New("no signing key")
+	_, _, err = Get(srv.URL).URLProcessor(func(*url.URL) error { return abort }).Text()
+	if !errors.Is(err, abort) {
+		t.Errorf("got %v, want %v", err, abort)
+	}
+}
+
+func TestTerminalContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var obj map[string]interface{}
+	methods := map[string]func(a *Agent, ctx context.Context) error{
+		"Bytes":         func(a *Agent, ctx context.Context) error { _, _, err := a.ContextBytes(ctx); return err },
+		"Text":          func(a *Agent, ctx context.Context) error { _, _, err := a.ContextText(ctx); return err },
+		"Status":        func(a *Agent, ctx context.Context) error { _, _, err := a.ContextStatus(ctx); return err },
+		"Discard":       func(a *Agent, ctx context.Context) error { _, err := a.ContextDiscard(ctx); return err },
+		"Exists":        func(a *Agent, ctx context.Context) error { _, err := a.ContextExists(ctx); return err },
+		"ContentLength": func(a *Agent, ctx context.Context) error { _, err := a.ContextContentLength(ctx); return err },
+		"Response":      func(a *Agent, ctx context.Context) error { _, err := a.ContextResponse(ctx); return err },
+		"JSON":          func(a *Agent, ctx context.Context) error { _, err := a.ContextJSON(ctx, &obj); return err },
+		"JSONError":     func(a *Agent, ctx context.Context) error { _, err := a.ContextJSONError(ctx, &obj, &obj); return err },
+		"JSONPath":      func(a *Agent, ctx context.Context) error { _, _, err := a.ContextJSONPath(ctx, "a"); return err },
+		"XML":           func(a *Agent, ctx context.Context) error { _, err := a.ContextXML(ctx, &obj); return err },
+		"YAML":          func(a *Agent, ctx context.Context) error { _, err := a.ContextYAML(ctx, &obj); return err },
+		"Msgpack":       func(a *Agent, ctx context.Context) error { _, err := a.ContextMsgpack(ctx, &obj); return err },
+		"CBOR":          func(a *Agent, ctx context.Context) error { _, err := a.ContextCBOR(ctx, &obj); return err },
+		"Decode":        func(a *Agent, ctx context.Context) error { _, err := a.ContextDecode(ctx, &obj); return err },
+		"DoInto": func(a *Agent, ctx context.Context) error {
+			_, _, err := ContextDoInto[map[string]int](ctx, a)
+			return err
+		},
+		"Protobuf": func(a *Agent, ctx context.Context) error {
+			_, err := a.ContextProtobuf(ctx, &timestamp.Timestamp{})
+			return err
+		},
+		"Download": func(a *Agent, ctx context.Context) error {
+			_, _, err := a.ContextDownload(ctx, t.TempDir()+"/out")
+			return err
+		},
+	}
+	for name, method := range methods {
+		//! an explicit context wins over the stored one
+		if err := method(Get(srv.URL).Context(context.Background()), ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Context%s: got %v", name, err)
+		}
+	}
+
+	stored := map[string]func(a *Agent) error{
+		"Bytes":         func(a *Agent) error { _, _, err := a.Bytes(); return err },
+		"Text":          func(a *Agent) error { _, _, err := a.Text(); return err },
+		"Status":        func(a *Agent) error { _, _, err := a.Status(); return err },
+		"Discard":       func(a *Agent) error { _, err := a.Discard(); return err },
+		"Exists":        func(a *Agent) error { _, err := a.Exists(); return err },
+		"ContentLength": func(a *Agent) error { _, err := a.ContentLength(); return err },
+		"Response":      func(a *Agent) error { _, err := a.Response(); return err },
+		"JSON":          func(a *Agent) error { _, err := a.JSON(&obj); return err },
+		"JSONError":     func(a *Agent) error { _, err := a.JSONError(&obj, &obj); return err },
+		"JSONPath":      func(a *Agent) error { _, _, err := a.JSONPath("a"); return err },
+		"XML":           func(a *Agent) error { _, err := a.XML(&obj); return err },
+		"YAML":          func(a *Agent) error { _, err := a.YAML(&obj); return err },
+		"Msgpack":       func(a *Agent) error { _, err := a.Msgpack(&obj); return err },
+		"CBOR":          func(a *Agent) error { _, err := a.CBOR(&obj); return err },
+		"Decode":        func(a *Agent) error { _, err := a.Decode(&obj); return err },
+		"DoInto":        func(a *Agent) error { _, _, err := DoInto[map[string]int](a); return err },
+		"Protobuf":      func(a *Agent) error { _, err := a.Protobuf(&timestamp.Timestamp{}); return err },
+		"Download":      func(a *Agent) error { _, _, err := a.Download(t.TempDir() + "/out"); return err },
+	}
+	for name, method := range stored {
+		if err := method(Get(srv.URL).Context(ctx)); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
+
+func TestDataMarshalError(t *testing.T) {
+	ch := make(chan int)
+	for name, agent := range map[string]*Agent{
+		"JSONData":       Post("http://localhost").JSONData(ch),
+		"JSONDataIndent": Post("http://localhost").JSONDataIndent(ch, "", "  "),
+		"XMLData":        Post("http://localhost").XMLData(ch),
+		"YAMLData":       Post("http://localhost").YAMLData(ch),
+		"MsgpackData":    Post("http://localhost").MsgpackData(ch),
+		"CBORData":       Post("http://localhost").CBORData(ch),
+	} {
+		if agent.Error == nil {
+			t.Errorf("%s: expected error", name)
+			continue
+		}
+		if prefix := "api: " + name + " marshal chan int: "; !strings.HasPrefix(agent.Error.Error(), prefix) {
+			t.Errorf("%s: got %q, want prefix %q", name, agent.Error, prefix)
+		}
+	}
+
+	var unsupported *json.UnsupportedTypeError
+	if err := Post("http://localhost").JSONData(ch).Error; !errors.As(err, &unsupported) {
+		t.Errorf("json error not wrapped: %v", err)
+	}
+	if err := Post("http://localhost").JSONData(map[string]int{"a": 1}).Error; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultBatchConcurrency is the number of requests Batch sends at once.
+const DefaultBatchConcurrency = 8
+
+// BatchResult is the outcome of one request of a batch: its fully read
+// response, and the error of ContextResponse if any.
+type BatchResult struct {
+	Response *Response
+	Error    error
+}
+
+// Batch sends the requests of agents concurrently, DefaultBatchConcurrency
+// at a time, see BatchN.
+func Batch(ctx context.Context, agents ...*Agent) ([]*BatchResult, error) {
+	return BatchN(ctx, DefaultBatchConcurrency, agents...)
+}
+
+// BatchN sends the requests of agents with at most n in flight, n < 1
+// meaning all at once, and returns their results in the order of agents.
+// Once ctx is done, the requests not started yet fail with its error, which
+// is also returned. Agents must not be shared between entries.
+func BatchN(ctx context.Context, n int, agents ...*Agent) ([]*BatchResult, error) {
+	if n < 1 || n > len(agents) {
+		n = len(agents)
+	}
+	results := make([]*BatchResult, len(agents))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			results[i] = &BatchResult{Error: err}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, agent *Agent) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			resp, err := agent.ContextResponse(ctx)
+			results[i] = &BatchResult{Response: resp, Error: err}
+		}(i, agent)
+	}
+	wg.Wait()
+	return results, ctx.Err()
+}
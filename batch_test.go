@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	var inflight, peak int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		//! later requests answer first
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		time.Sleep(time.Duration(10-id) * 5 * time.Millisecond)
+		if id == 7 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprintf(w, "item %d", id)
+	}))
+	defer srv.Close()
+
+	agents := make([]*Agent, 10)
+	for i := range agents {
+		agents[i] = Get(srv.URL).QuerySet("id", strconv.Itoa(i))
+	}
+	results, err := BatchN(context.Background(), 3, agents...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		var apiErr *APIError
+		if i == 7 {
+			if !errors.As(result.Error, &apiErr) || result.Response.StatusCode != http.StatusNotFound {
+				t.Errorf("result 7: %+v", result)
+			}
+			continue
+		}
+		if result.Error != nil || string(result.Response.Body) != fmt.Sprintf("item %d", i) {
+			t.Errorf("result %d: %v, %q", i, result.Error, result.Response.Body)
+		}
+	}
+	if p := atomic.LoadInt32(&peak); p > 3 {
+		t.Errorf("%d requests in flight, limit 3", p)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = Batch(ctx, Get(srv.URL), Get(srv.URL))
+	if !errors.Is(err, context.Canceled) || len(results) != 2 || !errors.Is(results[1].Error, context.Canceled) {
+		t.Errorf("cancelled batch: %v, %+v", err, results)
+	}
+}
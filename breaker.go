@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request while the
+// circuit breaker of the target host is open.
+var ErrCircuitOpen = errors.New("api: circuit open")
+
+// CircuitBreaker stops sending requests to a host for cooldown once
+// threshold consecutive requests to it failed with a transport error or a
+// 5xx status. After the cooldown a single probe request is let through,
+// closing the circuit on success and opening it again on failure. Clones
+// share the breaker state of their template.
+func (a *Agent) CircuitBreaker(threshold int, cooldown time.Duration) *Agent {
+	a.breaker = &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		circuits:  make(map[string]*circuit),
+	}
+	return a
+}
+
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuit struct {
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+func (b *circuitBreaker) allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		return nil
+	}
+	switch c.state {
+	case circuitOpen:
+		if now().Sub(c.openedAt) < b.cooldown {
+			return fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+		}
+		c.state = circuitHalfOpen
+	case circuitHalfOpen:
+		//! only one probe at a time
+		return fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+	}
+	return nil
+}
+
+func (b *circuitBreaker) record(host string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		if !failed {
+			return
+		}
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+	if !failed {
+		c.state, c.failures = circuitClosed, 0
+		return
+	}
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= b.threshold {
+		c.state, c.openedAt = circuitOpen, now()
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits int32
+	var failing atomic.Value
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if failing.Load().(bool) {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).CircuitBreaker(2, 100*time.Millisecond)
+	status := func() (int, error) {
+		code, _, err := base.Clone().Status()
+		return code, err
+	}
+
+	//! closed: failures reach the server until the threshold
+	for i := 0; i < 2; i++ {
+		if code, err := status(); err != nil || code != http.StatusBadGateway {
+			t.Fatalf("request %d: got %d, %v", i, code, err)
+		}
+	}
+
+	//! open: short-circuited
+	if _, err := status(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if hits != 2 {
+		t.Errorf("server saw %d requests while open, want 2", hits)
+	}
+
+	//! half-open: a failing probe opens it again
+	time.Sleep(120 * time.Millisecond)
+	if code, err := status(); err != nil || code != http.StatusBadGateway {
+		t.Fatalf("probe: got %d, %v", code, err)
+	}
+	if _, err := status(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after failed probe, got %v", err)
+	}
+
+	//! half-open: a successful probe closes it
+	failing.Store(false)
+	time.Sleep(120 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if code, err := status(); err != nil || code != http.StatusOK {
+			t.Fatalf("closed request %d: got %d, %v", i, code, err)
+		}
+	}
+	if hits != 6 {
+		t.Errorf("server saw %d requests, want 6", hits)
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores responses for Agent.Cache by key.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// MemoryCache is an in-memory Cache safe for concurrent use. It never
+// evicts entries, expired responses are only replaced.
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string][]byte)}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+}
+
+// Cache serves successful GET and HEAD responses from store for ttl
+// instead of sending the request again. Once expired, responses with an
+// ETag or Last-Modified header are revalidated with a conditional request
+// and served again on 304 Not Modified. Responses marked
+// "Cache-Control: no-store", or requested with it, are not cached.
+// Responses are cached per Accept, Accept-Encoding, Authorization and
+// Cookie request header, responses varying on other headers are not cached.
+func (a *Agent) Cache(store Cache, ttl time.Duration) *Agent {
+	a.cache = &responseCache{store: store, ttl: ttl}
+	return a
+}
+
+// FromCache reports whether the last response was served from the cache
+// without a round trip. Revalidated responses made one and report false.
+func (a *Agent) FromCache() bool {
+	return a.fromCache
+}
+
+type responseCache struct {
+	store Cache
+	ttl   time.Duration
+}
+
+func cacheable(req *http.Request) bool {
+	return (req.Method == GET || req.Method == HEAD) &&
+		!strings.Contains(req.Header.Get("Cache-Control"), "no-store")
+}
+
+// cacheVary are the request headers responses are cached by.
+var cacheVary = map[string]bool{"Accept": true, "Accept-Encoding": true, "Authorization": true, "Cookie": true}
+
+func cacheKey(req *http.Request) string {
+	//! credentials are hashed, not stored in the key
+	credentials := sha256.Sum256([]byte(req.Header.Get("Authorization") + "\n" + req.Header.Get("Cookie")))
+	return req.Method + " " + req.URL.String() + "\n" +
+		req.Header.Get("Accept") + "\n" + req.Header.Get("Accept-Encoding") + "\n" +
+		hex.EncodeToString(credentials[:])
+}
+
+// varies reports whether resp varies on request headers outside cacheVary.
+func varies(resp *http.Response) bool {
+	for _, vary := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name != "" && !cacheVary[http.CanonicalHeaderKey(name)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type cacheEntry struct {
+	expires int64
+	dump    []byte
+}
+
+func (e *cacheEntry) response(req *http.Request) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(e.dump)), req)
+}
+
+func (c *responseCache) entry(req *http.Request) (*cacheEntry, bool) {
+	if !cacheable(req) {
+		return nil, false
+	}
+	value, ok := c.store.Get(cacheKey(req))
+	if !ok {
+		return nil, false
+	}
+	idx := bytes.IndexByte(value, '\n')
+	if idx < 0 {
+		return nil, false
+	}
+	expires, err := strconv.ParseInt(string(value[:idx]), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &cacheEntry{expires: expires, dump: value[idx+1:]}, true
+}
+
+func (c *responseCache) put(req *http.Request, dump []byte) *cacheEntry {
+	entry := &cacheEntry{expires: now().Add(c.ttl).UnixNano(), dump: dump}
+	value := append([]byte(strconv.FormatInt(entry.expires, 10)+"\n"), dump...)
+	c.store.Set(cacheKey(req), value)
+	return entry
+}
+
+// lookup returns the cached response for req while it is fresh. A stale
+// entry carrying an ETag or Last-Modified validator is returned instead,
+// after adding the matching conditional headers to req.
+func (c *responseCache) lookup(req *http.Request) (*http.Response, *cacheEntry) {
+	entry, ok := c.entry(req)
+	if !ok {
+		return nil, nil
+	}
+	resp, err := entry.response(req)
+	if err != nil {
+		return nil, nil
+	}
+	if now().UnixNano() < entry.expires {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return nil, nil
+	}
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && modified == "" {
+		return nil, nil
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+	return nil, entry
+}
+
+// revalidated serves the stale entry again for another ttl after the
+// server answered 304 Not Modified.
+func (c *responseCache) revalidated(req *http.Request, resp *http.Response, stale *cacheEntry) (*http.Response, error) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return c.put(req, stale.dump).response(req)
+}
+
+// save stores a successful response for req, the returned response must
+// be used in place of resp as its body has been read.
+func (c *responseCache) save(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if !cacheable(req) || !isSuccess(resp.StatusCode) ||
+		strings.Contains(resp.Header.Get("Cache-Control"), "no-store") || varies(resp) {
+		return resp, nil
+	}
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	c.put(req, dump)
+	return resp, nil
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Header().Set("X-Hit", fmt.Sprint(n))
+		fmt.Fprintf(w, "response %d", n)
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).Cache(NewMemoryCache(), 100*time.Millisecond)
+	get := func(path string) string {
+		agent := base.Clone().URI(path)
+		_, text, err := agent.Text()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hit := agent.GetHeadOut().Get("X-Hit"); text != "response "+hit {
+			t.Errorf("header X-Hit %s does not match body %q", hit, text)
+		}
+		return text
+	}
+
+	if text := get("/a"); text != "response 1" {
+		t.Errorf("miss: got %q", text)
+	}
+	if text := get("/a"); text != "response 1" {
+		t.Errorf("hit: got %q", text)
+	}
+	if text := get("/b"); text != "response 2" {
+		t.Errorf("other url: got %q", text)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if text := get("/a"); text != "response 3" {
+		t.Errorf("expired: got %q", text)
+	}
+
+	get("/private")
+	if text := get("/private"); text != "response 5" {
+		t.Errorf("no-store: got %q", text)
+	}
+
+	if _, _, err := base.Clone().Method(POST).URI("/a").Text(); err != nil || hits != 6 {
+		t.Errorf("POST was served from cache: %d hits, %v", hits, err)
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	var hits, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/etag" {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		} else {
+			modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		}
+		w.Write([]byte("large resource"))
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/etag", "/modified"} {
+		hits, notModified = 0, 0
+		base := Get(srv.URL).URI(path).Cache(NewMemoryCache(), 50*time.Millisecond)
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				time.Sleep(60 * time.Millisecond)
+			}
+			code, text, err := base.Clone().Text()
+			if err != nil || code != http.StatusOK || text != "large resource" {
+				t.Fatalf("%s request %d: got %d, %q, %v", path, i, code, text, err)
+			}
+		}
+		//! refreshed entries are fresh again
+		if _, text, _ := base.Clone().Text(); text != "large resource" {
+			t.Errorf("%s: got %q", path, text)
+		}
+		if hits != 3 || notModified != 2 {
+			t.Errorf("%s: %d hits, %d not modified, want 3 and 2", path, hits, notModified)
+		}
+	}
+}
+
+func TestFromCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("cached"))
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).Cache(NewMemoryCache(), time.Minute)
+	if _, _, err := agent.Text(); err != nil || agent.FromCache() {
+		t.Errorf("miss: from cache %v, %v", agent.FromCache(), err)
+	}
+	if _, _, err := agent.Text(); err != nil || !agent.FromCache() {
+		t.Errorf("hit: from cache %v, %v", agent.FromCache(), err)
+	}
+	if _, _, err := agent.Method(POST).Text(); err != nil || agent.FromCache() {
+		t.Errorf("not reset: from cache %v, %v", agent.FromCache(), err)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Vary", "Accept, Authorization")
+		if r.URL.Path == "/language" {
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		fmt.Fprintf(w, "auth=%s accept=%s", r.Header.Get("Authorization"), r.Header.Get("Accept"))
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).Cache(NewMemoryCache(), time.Minute)
+	alice := base.Clone().BearerToken("alice").Accept("json")
+	bob := base.Clone().BearerToken("bob").Accept("xml")
+	for i := 0; i < 2; i++ {
+		if _, text, _ := alice.Clone().Text(); text != "auth=Bearer alice accept=application/json" {
+			t.Errorf("alice %d: got %q", i, text)
+		}
+		if _, text, _ := bob.Clone().Text(); text != "auth=Bearer bob accept=application/xml" {
+			t.Errorf("bob %d: got %q", i, text)
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("server saw %d requests, want 2", n)
+	}
+
+	base.Clone().URI("/language").Text()
+	base.Clone().URI("/language").Text()
+	if n := atomic.LoadInt32(&hits); n != 4 {
+		t.Errorf("response varying on Accept-Language was cached: %d requests", n)
+	}
+}
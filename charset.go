@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// Charset decodes every response body from the charset name, such as gbk
+// or shift_jis, into UTF-8, whatever charset its Content-Type declares.
+// Without it, only text, JSON, XML and YAML responses declaring a charset
+// other than UTF-8 are decoded.
+func (a *Agent) Charset(name string) *Agent {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		a.Error = fmt.Errorf("api: unsupported charset %q", name)
+		return a
+	}
+	a.charset = enc
+	return a
+}
+
+func isTextMedia(media string) bool {
+	switch {
+	case strings.HasPrefix(media, "text/"),
+		media == "application/json", strings.HasSuffix(media, "+json"),
+		media == "application/xml", strings.HasSuffix(media, "+xml"),
+		media == "application/javascript", media == "application/x-ndjson",
+		media == "application/yaml", media == "application/x-yaml":
+		return true
+	}
+	return false
+}
+
+type charsetBody struct {
+	io.Reader
+	io.Closer
+}
+
+// transcode decodes the response body into UTF-8 from the charset forced
+// by Charset or else declared by a textual Content-Type. Unknown declared
+// charsets are left as is.
+func (a *Agent) transcode(resp *http.Response) {
+	if resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified ||
+		(resp.Request != nil && resp.Request.Method == HEAD) {
+		return
+	}
+
+	media, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	enc := a.charset
+	if enc == nil {
+		if err != nil || params["charset"] == "" || !isTextMedia(media) {
+			return
+		}
+		if enc, err = htmlindex.Get(params["charset"]); err != nil {
+			return
+		}
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" || enc == encoding.Nop {
+		return
+	}
+
+	resp.Body = &charsetBody{Reader: transform.NewReader(resp.Body, enc.NewDecoder()), Closer: resp.Body}
+	if media != "" {
+		if params == nil {
+			params = map[string]string{}
+		}
+		params["charset"] = "utf-8"
+		resp.Header.Set("Content-Type", mime.FormatMediaType(media, params))
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+}
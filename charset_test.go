@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestCharset(t *testing.T) {
+	const text = "你好，世界"
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String(text)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain; charset=GBK")
+			w.Write([]byte(gbk))
+		case "/json":
+			w.Header().Set("Content-Type", "application/json; charset=gbk")
+			w.Write([]byte(`{"greeting":"` + gbk + `"}`))
+		case "/undeclared":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(gbk))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream; charset=gbk")
+			w.Write([]byte(gbk))
+		}
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).URI("/text")
+	if _, got, err := agent.Text(); err != nil || got != text {
+		t.Errorf("text: %q, %v", got, err)
+	}
+	if ct := agent.GetHeadOut().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("text: Content-Type %q", ct)
+	}
+
+	var obj struct {
+		Greeting string `json:"greeting"`
+	}
+	if _, err := Get(srv.URL).URI("/json").JSON(&obj); err != nil || obj.Greeting != text {
+		t.Errorf("json: %+v, %v", obj, err)
+	}
+	obj.Greeting = ""
+	if _, err := Get(srv.URL).URI("/json").Decode(&obj); err != nil || obj.Greeting != text {
+		t.Errorf("decode: %+v, %v", obj, err)
+	}
+
+	if _, got, err := Get(srv.URL).URI("/undeclared").Text(); err != nil || got != gbk {
+		t.Errorf("undeclared: %q, %v", got, err)
+	}
+	if _, got, err := Get(srv.URL).URI("/undeclared").Charset("gbk").Text(); err != nil || got != text {
+		t.Errorf("forced: %q, %v", got, err)
+	}
+	if _, got, err := Get(srv.URL).URI("/binary").Bytes(); err != nil || string(got) != gbk {
+		t.Errorf("binary: %q, %v", got, err)
+	}
+
+	if _, _, err := Get(srv.URL).Charset("klingon").Text(); err == nil {
+		t.Error("expected error for an unknown charset")
+	}
+}
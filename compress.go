@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressRequest compresses the request body with gzip or deflate and sets
+// Content-Encoding accordingly. Empty bodies are sent as is. With a cipher,
+// the encrypted body is compressed, so the server decodes the
+// Content-Encoding before decrypting.
+func (a *Agent) CompressRequest(algo string) *Agent {
+	algo = strings.ToLower(algo)
+	if algo != "gzip" && algo != "deflate" {
+		a.Error = fmt.Errorf("api: unsupported request compression %q", algo)
+		return a
+	}
+	a.compress = algo
+	return a
+}
+
+func newCompressWriter(algo string, w io.Writer) io.WriteCloser {
+	if algo == "deflate" {
+		return zlib.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+func compressStream(algo string, rd io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		zw := newCompressWriter(algo, pw)
+		if _, err := io.Copy(zw, rd); err != nil {
+			//! unblock a streaming source when the request is aborted
+			if c, ok := rd.(io.Closer); ok {
+				c.Close()
+			}
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(zw.Close())
+	}()
+	return pr
+}
+
+func compressBytes(algo string, data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := newCompressWriter(algo, buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AcceptEncoding advertises the content encodings the agent can decode,
+// gzip, deflate and br by default. Responses in those encodings are
+// decompressed transparently.
+func (a *Agent) AcceptEncoding(encodings ...string) *Agent {
+	if len(encodings) == 0 {
+		encodings = []string{"gzip", "deflate", "br"}
+	}
+	a.headerIn.Set("Accept-Encoding", strings.Join(encodings, ", "))
+	return a
+}
+
+type decompressBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+func (b *decompressBody) Close() error {
+	if c, ok := b.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return b.body.Close()
+}
+
+func decompress(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified ||
+		(resp.Request != nil && resp.Request.Method == HEAD) {
+		return nil
+	}
+
+	var rd io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		rd = zr
+	case "deflate":
+		//! deflate is zlib wrapped per RFC 7230, but raw streams are common
+		br := bufio.NewReader(resp.Body)
+		if hdr, err := br.Peek(2); err == nil && hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return err
+			}
+			rd = zr
+		} else {
+			rd = flate.NewReader(br)
+		}
+	case "br":
+		rd = brotli.NewReader(resp.Body)
+	default:
+		return nil
+	}
+
+	resp.Body = &decompressBody{Reader: rd, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestDecompressResponse(t *testing.T) {
+	payload := strings.Repeat("hello compressed world ", 64)
+
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("encoding")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), strings.TrimPrefix(name, "raw-")) {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		var buf bytes.Buffer
+		zw := encoders[name](&buf)
+		zw.Write([]byte(payload))
+		zw.Close()
+		w.Header().Set("Content-Encoding", strings.TrimPrefix(name, "raw-"))
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	for name := range encoders {
+		agent := Get(srv.URL).QuerySet("encoding", name).AcceptEncoding()
+		code, text, err := agent.Text()
+		if err != nil {
+			t.Fatalf("%s: %d, %v", name, code, err)
+		}
+		if text != payload {
+			t.Errorf("%s: got %q", name, text)
+		}
+		if enc := agent.GetHeadOut().Get("Content-Encoding"); enc != "" {
+			t.Errorf("%s: Content-Encoding %q not cleared", name, enc)
+		}
+	}
+}
+
+func TestCompressRequest(t *testing.T) {
+	payload := map[string]string{"text": strings.Repeat("compress me ", 256)}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rd io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			rd = zr
+		case "deflate":
+			zr, err := zlib.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			rd = zr
+		}
+		body, _ := ioutil.ReadAll(rd)
+		w.Header().Set("X-Wire-Length", strconv.FormatInt(r.ContentLength, 10))
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	for _, algo := range []string{"gzip", "deflate"} {
+		agent := Post(srv.URL).JSONData(payload).CompressRequest(algo)
+		out := map[string]string{}
+		if _, err := agent.JSON(&out); err != nil {
+			t.Fatalf("%s: %v", algo, err)
+		}
+		if out["text"] != payload["text"] {
+			t.Errorf("%s: payload mismatch", algo)
+		}
+		if n, _ := strconv.Atoi(agent.GetHeadOut().Get("X-Wire-Length")); n <= 0 || n >= len(payload["text"]) {
+			t.Errorf("%s: wire length %d not compressed", algo, n)
+		}
+	}
+
+	//! the stored body is compressed anew, never twice
+	agent := Post(srv.URL).JSONData(payload).CompressRequest("gzip")
+	for i := 0; i < 2; i++ {
+		out := map[string]string{}
+		if _, err := agent.JSON(&out); err != nil || out["text"] != payload["text"] {
+			t.Errorf("send %d: %v", i, err)
+		}
+	}
+	agent = Post(srv.URL).JSONData(payload).CompressRequest("gzip")
+	if _, err := agent.Request(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := agent.Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if out := map[string]string{}; json.Unmarshal(body, &out) != nil || out["text"] != payload["text"] {
+		t.Errorf("Do after Request: got %.40q", body)
+	}
+
+	if _, _, err := Post(srv.URL).CompressRequest("br").Text(); err == nil {
+		t.Error("expected error for unsupported algorithm")
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Curl renders the request as an equivalent curl command line without
+// sending it. Authorization and credentials in the URL are redacted unless
+// withAuth is true. Multipart
+// files are referenced by name with -F field=@filename.
+func (a *Agent) Curl(withAuth ...bool) (string, error) {
+	reveal := len(withAuth) > 0 && withAuth[0]
+
+	agent := a
+	if len(a.files) > 0 || len(a.fields) > 0 {
+		//! the multipart body is rendered as -F flags instead
+		agent = a.Clone()
+		agent.files, agent.fields = nil, nil
+		agent.t = ""
+	}
+
+	req, err := agent.Request(a.context())
+	if err != nil {
+		return "", err
+	}
+	if a.oauth2 != nil {
+		//! the token is only fetched when sending
+		req.Header.Set("Authorization", "Bearer <oauth2 token>")
+	}
+
+	args := []string{"curl"}
+	if req.Method != GET {
+		args = append(args, "-X", req.Method)
+	}
+	u := *req.URL
+	if !reveal {
+		u.User = nil
+	}
+	args = append(args, shellQuote(u.String()))
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			if k == "Authorization" && !reveal {
+				v = "REDACTED"
+			}
+			args = append(args, "-H", shellQuote(k+": "+v))
+		}
+	}
+
+	for _, field := range a.fields {
+		if field.file != nil {
+			args = append(args, "-F", shellQuote(curlFileForm(field.file)))
+			continue
+		}
+		args = append(args, "--form-string", shellQuote(field.name+"="+field.value))
+	}
+	for _, file := range a.files {
+		args = append(args, "-F", shellQuote(curlFileForm(file)))
+	}
+
+	body, err := requestBody(req)
+	switch {
+	case err != nil:
+		args = append(args, "--data-binary", "@-")
+	case len(body) == 0:
+	case utf8.Valid(body):
+		args = append(args, "--data-binary", shellQuote(string(body)))
+	default:
+		args = append(args, "--data-binary", "@-")
+	}
+	return strings.Join(args, " "), nil
+}
+
+func curlFileForm(file *File) string {
+	form := file.Fieldname + "=@" + file.Filename
+	if file.ContentType != "" {
+		form += ";type=" + file.ContentType
+	}
+	return form
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
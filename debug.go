@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+)
+
+// RedactHeaders replaces the values of the named headers with REDACTED in
+// Debug dumps, Authorization, Cookie and Set-Cookie by default.
+func (a *Agent) RedactHeaders(names ...string) *Agent {
+	if len(names) == 0 {
+		names = []string{"Authorization", "Cookie", "Set-Cookie"}
+	}
+	a.redact = make(map[string]bool, len(names))
+	for _, name := range names {
+		a.redact[http.CanonicalHeaderKey(name)] = true
+	}
+	return a
+}
+
+// Logger sets the printf-style function receiving Debug output instead of
+// the standard log package. A nil fn restores log.Printf.
+func (a *Agent) Logger(fn func(format string, args ...interface{})) *Agent {
+	a.logger = fn
+	return a
+}
+
+func (a *Agent) debugDump(title string, dump []byte) {
+	logf := a.logger
+	if logf == nil {
+		logf = log.Printf
+	}
+	logf("%s\n-------------------------------\n%s\n", title, string(a.redactDump(dump)))
+}
+
+func (a *Agent) redactDump(dump []byte) []byte {
+	if len(a.redact) == 0 {
+		return dump
+	}
+	//! only the header block, up to the first empty line, is rewritten
+	head, body := dump, []byte(nil)
+	if i := bytes.Index(dump, []byte("\r\n\r\n")); i >= 0 {
+		head, body = dump[:i], dump[i:]
+	}
+	lines := bytes.Split(head, []byte("\r\n"))
+	for i, line := range lines[1:] {
+		colon := bytes.IndexByte(line, ':')
+		if colon > 0 && a.redact[http.CanonicalHeaderKey(string(line[:colon]))] {
+			lines[i+1] = append(line[:colon:colon], ": REDACTED"...)
+		}
+	}
+	out := bytes.Join(lines, []byte("\r\n"))
+	return append(out, body...)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "server-secret"})
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	_, _, err := Get(srv.URL).Debug(true).RedactHeaders().
+		BearerToken("token-secret").
+		CookiesAdd(&http.Cookie{Name: "sid", Value: "cookie-secret"}).
+		HeadSet("X-Trace", "visible").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump := buf.String()
+	for _, secret := range []string{"token-secret", "cookie-secret", "server-secret"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("%s leaked in debug output:\n%s", secret, dump)
+		}
+	}
+	for _, want := range []string{"Authorization: REDACTED", "Set-Cookie: REDACTED", "X-Trace: visible", "ok"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("%q missing from debug output:\n%s", want, dump)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("logged body"))
+	}))
+	defer srv.Close()
+
+	var lines []string
+	logf := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	if _, _, err := Get(srv.URL).Debug(true).Logger(logf).Text(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "api request") || !strings.Contains(lines[len(lines)-1], "logged body") {
+		t.Errorf("got %q", lines)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	if _, _, err := Get(srv.URL).Debug(true).Logger(nil).Text(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "logged body") {
+		t.Errorf("nil logger did not fall back to log: %q", buf.String())
+	}
+}
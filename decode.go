@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Decode decodes the response into obj with the decoder matching its
+// Content-Type: JSON, XML, YAML, msgpack, CBOR or protobuf. Any other type
+// is an error.
+func (a *Agent) Decode(obj interface{}) (int, error) {
+	return a.ContextDecode(a.context(), obj)
+}
+
+func (a *Agent) ContextDecode(ctx context.Context, obj interface{}) (int, error) {
+	accept := "application/json, application/xml, application/yaml, application/msgpack, application/cbor, application/x-protobuf"
+	resp, err := a.Do(withAccept(ctx, accept))
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	if obj == nil || resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, a.Error
+	}
+
+	media, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case media == "application/json" || strings.HasSuffix(media, "+json"):
+		err = a.decodeJSON(resp.Body, obj)
+	case media == "application/xml" || media == "text/xml" || strings.HasSuffix(media, "+xml"):
+		err = xml.NewDecoder(resp.Body).Decode(obj)
+	case media == "application/yaml" || media == "application/x-yaml" || media == "text/yaml":
+		err = yaml.NewDecoder(resp.Body).Decode(obj)
+	case media == "application/msgpack" || media == "application/x-msgpack":
+		err = msgpack.NewDecoder(resp.Body).Decode(obj)
+	case media == "application/cbor":
+		err = cbor.NewDecoder(resp.Body).Decode(obj)
+	case media == "application/x-protobuf" || media == "application/protobuf":
+		msg, ok := obj.(proto.Message)
+		if !ok {
+			err = fmt.Errorf("api: protobuf response needs a proto.Message, got %T", obj)
+			break
+		}
+		var body []byte
+		if body, err = ioutil.ReadAll(resp.Body); err == nil {
+			err = proto.Unmarshal(body, msg)
+		}
+	default:
+		err = fmt.Errorf("api: cannot decode content type %q, want json, xml, yaml, msgpack, cbor or protobuf", resp.Header.Get("Content-Type"))
+	}
+	if err != nil {
+		a.Error = err
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, a.Error
+}
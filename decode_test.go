@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	type item struct {
+		XMLName xml.Name `json:"-" xml:"item"`
+		Name    string   `json:"name" xml:"name"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := item{Name: "from " + r.URL.Path[1:]}
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(v)
+		case "/xml":
+			w.Header().Set("Content-Type", "text/xml")
+			xml.NewEncoder(w).Encode(v)
+		default:
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("name\n"))
+		}
+	}))
+	defer srv.Close()
+
+	for _, format := range []string{"json", "xml"} {
+		var v item
+		if _, err := Get(srv.URL).URI("/" + format).Decode(&v); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if v.Name != "from "+format {
+			t.Errorf("%s: got %+v", format, v)
+		}
+	}
+
+	var v item
+	if _, err := Get(srv.URL).URI("/csv").Decode(&v); err == nil || !strings.Contains(err.Error(), "text/csv") {
+		t.Errorf("got %v", err)
+	}
+}
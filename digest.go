@@ -0,0 +1,180 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestAuth answers a "WWW-Authenticate: Digest" challenge by resending
+// the request once with the computed Authorization header. MD5, SHA-256
+// and their -sess variants are supported, with qop=auth or no qop.
+func (a *Agent) DigestAuth(user, password string) *Agent {
+	a.digest = &digestAuth{user: user, password: password}
+	return a
+}
+
+type digestAuth struct {
+	user     string
+	password string
+
+	mu sync.Mutex
+	nc uint32
+}
+
+// parseAuthParams parses the comma separated key=value pairs of an
+// authentication header, values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i < len(s) {
+				i++
+			}
+			value, s = b.String(), s[i:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func (d *digestAuth) challenge(resp *http.Response) (map[string]string, bool) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, false
+	}
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		if len(value) > 7 && strings.EqualFold(value[:7], "Digest ") {
+			return parseAuthParams(value[7:]), true
+		}
+	}
+	return nil, false
+}
+
+func (d *digestAuth) authorization(chal map[string]string, method, uri string) (string, error) {
+	algorithm := chal["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("api: unsupported digest algorithm %q", algorithm)
+	}
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	qop := ""
+	if chal["qop"] != "" {
+		for _, q := range strings.Split(chal["qop"], ",") {
+			if strings.TrimSpace(q) == "auth" {
+				qop = "auth"
+			}
+		}
+		if qop == "" {
+			return "", fmt.Errorf("api: unsupported digest qop %q", chal["qop"])
+		}
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(buf)
+
+	d.mu.Lock()
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+	d.mu.Unlock()
+
+	realm, nonce := chal["realm"], chal["nonce"]
+	ha1 := h(d.user + ":" + realm + ":" + d.password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		d.user, realm, nonce, uri, algorithm, response)
+	if qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque, ok := chal["opaque"]; ok {
+		fmt.Fprintf(&b, `, opaque="%s"`, opaque)
+	}
+	return b.String(), nil
+}
+
+// authenticate resends req with digest credentials when resp is a digest
+// challenge, otherwise it returns resp untouched.
+func (d *digestAuth) authenticate(client *http.Client, req *http.Request, resp *http.Response) (*http.Response, error) {
+	chal, ok := d.challenge(resp)
+	if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	auth, err := d.authorization(chal, req.Method, req.URL.RequestURI())
+	if err != nil {
+		return resp, nil
+	}
+
+	next := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		next.Body = body
+	}
+	next.Header.Set("Authorization", auth)
+
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return client.Do(next)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func md5hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDigestAuth(t *testing.T) {
+	const realm, nonce, opaque = "api@example", "dcd98b7102dd2f0e8b11d0f600bfb0c093", "5ccc069c403ebaf9f0171e9517f40e41"
+
+	var challenges, bodies int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == `{"a":1}` {
+			bodies++
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Digest ") {
+			challenges++
+			w.Header().Set("WWW-Authenticate",
+				`Digest realm="`+realm+`", qop="auth,auth-int", nonce="`+nonce+`", opaque="`+opaque+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p := parseAuthParams(auth[7:])
+		ha1 := md5hex("mufasa:" + realm + ":circle of life")
+		ha2 := md5hex(r.Method + ":" + r.URL.RequestURI())
+		want := md5hex(ha1 + ":" + nonce + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+		if p["username"] != "mufasa" || p["uri"] != r.URL.RequestURI() || p["opaque"] != opaque || p["response"] != want {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("welcome"))
+	}))
+	defer srv.Close()
+
+	code, text, err := Post(srv.URL).URI("/dir/index.html").QuerySet("x", "1").
+		JSONData(map[string]int{"a": 1}).DigestAuth("mufasa", "circle of life").Text()
+	if err != nil {
+		t.Fatalf("digest auth failed: %d, %v", code, err)
+	}
+	if text != "welcome" || challenges != 1 || bodies != 2 {
+		t.Errorf("got %q after %d challenges, body sent %d times", text, challenges, bodies)
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	got := parseAuthParams(`realm="a, \"b\"", qop="auth,auth-int", algorithm=MD5, stale=FALSE`)
+	want := map[string]string{"realm": `a, "b"`, "qop": "auth,auth-int", "algorithm": "MD5", "stale": "FALSE"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when a response body does not match the
+// checksum given to VerifyChecksum.
+var ErrChecksumMismatch = errors.New("api: checksum mismatch")
+
+type checksum struct {
+	algo     string
+	hash     func() hash.Hash
+	expected string
+}
+
+func (c *checksum) verify(h hash.Hash) error {
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != c.expected {
+		return fmt.Errorf("%w: %s is %s, want %s", ErrChecksumMismatch, c.algo, sum, c.expected)
+	}
+	return nil
+}
+
+// VerifyChecksum checks the response body read by Bytes, Text, Download or
+// CopyTo against expectedHex, the md5, sha1 or sha256 digest named by algo.
+func (a *Agent) VerifyChecksum(algo, expectedHex string) *Agent {
+	c := &checksum{algo: strings.ToLower(algo), expected: strings.ToLower(expectedHex)}
+	switch c.algo {
+	case "md5":
+		c.hash = md5.New
+	case "sha1":
+		c.hash = sha1.New
+	case "sha256":
+		c.hash = sha256.New
+	default:
+		a.Error = fmt.Errorf("api: unsupported checksum algorithm %q", algo)
+		return a
+	}
+	a.checksum = c
+	return a
+}
+
+// Download streams the response body into the file at path, creating
+// parent directories as needed. It returns the status code and the number
+// of bytes written. The partial file is removed on error.
+func (a *Agent) Download(path string) (int, int64, error) {
+	return a.ContextDownload(a.context(), path)
+}
+
+func (a *Agent) ContextDownload(ctx context.Context, path string) (int, int64, error) {
+	return a.download(ctx, path, nil)
+}
+
+// DownloadProgress is Download reporting the bytes written so far and the
+// Content-Length of the response, or -1 when unknown, to fn. fn is called a
+// last time once the download completes.
+func (a *Agent) DownloadProgress(path string, fn func(written, total int64)) (int, int64, error) {
+	return a.ContextDownloadProgress(a.context(), path, fn)
+}
+
+func (a *Agent) ContextDownloadProgress(ctx context.Context, path string, fn func(written, total int64)) (int, int64, error) {
+	return a.download(ctx, path, fn)
+}
+
+func (a *Agent) download(ctx context.Context, path string, fn ProgressFunc) (int, int64, error) {
+	resp, err := a.Do(ctx)
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, 0, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, 0, a.Error
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		a.Error = err
+		return resp.StatusCode, 0, err
+	}
+	fd, err := os.Create(path)
+	if err != nil {
+		a.Error = err
+		return resp.StatusCode, 0, err
+	}
+
+	n, err := a.writeBody(resp, fd, fn)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		a.Error = err
+		return resp.StatusCode, n, err
+	}
+	if fn != nil {
+		fn(n, resp.ContentLength)
+	}
+	return resp.StatusCode, n, nil
+}
+
+// CopyTo streams the response body to w without buffering it, for
+// instance to os.Stdout, and returns the status code and the number of
+// bytes copied. Non-2xx responses are not copied and return an *APIError.
+// It is not named WriteTo, whose signature is reserved by io.WriterTo.
+func (a *Agent) CopyTo(w io.Writer) (int, int64, error) {
+	return a.ContextCopyTo(a.context(), w)
+}
+
+func (a *Agent) ContextCopyTo(ctx context.Context, w io.Writer) (int, int64, error) {
+	resp, err := a.Do(ctx)
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, 0, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, 0, a.Error
+	}
+
+	n, err := a.writeBody(resp, w, nil)
+	if err != nil {
+		a.Error = err
+	}
+	return resp.StatusCode, n, err
+}
+
+// writeBody copies the response body to w, reporting progress to fn, and
+// verifies the checksum of VerifyChecksum.
+func (a *Agent) writeBody(resp *http.Response, w io.Writer, fn ProgressFunc) (int64, error) {
+	var body io.Reader = resp.Body
+	if fn != nil {
+		body = &progressReader{ReadCloser: resp.Body, total: resp.ContentLength, fn: fn}
+	}
+	var h hash.Hash
+	if a.checksum != nil {
+		h = a.checksum.hash()
+		w = io.MultiWriter(w, h)
+	}
+
+	n, err := io.Copy(w, body)
+	if err == nil && h != nil {
+		err = a.checksum.verify(h)
+	}
+	return n, err
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownload(t *testing.T) {
+	payload := make([]byte, 3<<20)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "payload.bin", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "api-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nested", "payload.bin")
+	code, n, err := Get(srv.URL).Download(path)
+	if err != nil {
+		t.Fatalf("Download failed: %d, %v", code, err)
+	}
+	if n != int64(len(payload)) {
+		t.Errorf("wrote %d bytes, want %d", n, len(payload))
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha256.Sum256(data) != sha256.Sum256(payload) {
+		t.Error("downloaded file checksum mismatch")
+	}
+
+	missing := filepath.Join(dir, "missing.bin")
+	if code, _, err := Get(srv.URL).URI("/missing").Download(missing); err == nil || code != http.StatusNotFound {
+		t.Errorf("expected 404 error, got %d, %v", code, err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Error("file created for failed download")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	payload := []byte("integrity matters")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256(payload)
+	good := hex.EncodeToString(sum[:])
+	bad := strings.Repeat("0", len(good))
+
+	if _, body, err := Get(srv.URL).VerifyChecksum("sha256", good).Bytes(); err != nil || string(body) != string(payload) {
+		t.Errorf("matching Bytes: got %q, %v", body, err)
+	}
+	if _, _, err := Get(srv.URL).VerifyChecksum("sha256", bad).Bytes(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("mismatching Bytes: got %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "api-checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "good.bin")
+	if _, _, err := Get(srv.URL).VerifyChecksum("SHA256", good).Download(path); err != nil {
+		t.Errorf("matching Download: %v", err)
+	}
+	path = filepath.Join(dir, "bad.bin")
+	if _, _, err := Get(srv.URL).VerifyChecksum("sha256", bad).Download(path); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("mismatching Download: got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("mismatching download was kept")
+	}
+
+	if agent := Get(srv.URL).VerifyChecksum("crc32", good); agent.Error == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 100<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		} else {
+			w.Header().Set("Content-Length", fmt.Sprint(len(payload)))
+		}
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	for path, total := range map[string]int64{"/sized": int64(len(payload)), "/chunked": -1} {
+		var calls []int64
+		dst := filepath.Join(t.TempDir(), "file.bin")
+		_, n, err := Get(srv.URL).URI(path).DownloadProgress(dst, func(written, got int64) {
+			if got != total {
+				t.Errorf("%s: total %d, want %d", path, got, total)
+			}
+			if len(calls) > 0 && written < calls[len(calls)-1] {
+				t.Errorf("%s: written went back from %d to %d", path, calls[len(calls)-1], written)
+			}
+			calls = append(calls, written)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(payload)) || len(calls) < 2 || calls[len(calls)-1] != n {
+			t.Errorf("%s: wrote %d, progress %v", path, n, calls)
+		}
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	payload := bytes.Repeat([]byte("copy me "), 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+			return
+		}
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	code, n, err := Get(srv.URL).CopyTo(&buf)
+	if err != nil || code != http.StatusOK || n != int64(len(payload)) || !bytes.Equal(buf.Bytes(), payload) {
+		t.Errorf("buffer: %d, %d, %v", code, n, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.bin")
+	fd, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(payload)
+	code, n, err = Get(srv.URL).VerifyChecksum("sha256", hex.EncodeToString(sum[:])).CopyTo(fd)
+	fd.Close()
+	if err != nil || code != http.StatusOK || n != int64(len(payload)) {
+		t.Errorf("file: %d, %d, %v", code, n, err)
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, payload) {
+		t.Errorf("file holds %d bytes, want %d", len(got), len(payload))
+	}
+
+	buf.Reset()
+	var apiErr *APIError
+	code, n, err = Get(srv.URL).URI("/missing").CopyTo(&buf)
+	if !errors.As(err, &apiErr) || code != http.StatusNotFound || n != 0 || buf.Len() != 0 {
+		t.Errorf("missing: %d, %d, %v, %q", code, n, err, buf.String())
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// APIError is returned for non-2xx responses. Its message is the response
+// body, or the status line when the body is empty; use errors.As to get the
+// status code, headers and raw body.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	if len(e.Body) > 0 {
+		return string(e.Body)
+	}
+	return e.Status
+}
+
+// DefaultErrorBodyLimit is the number of bytes of a non-2xx response body
+// kept in an APIError unless ErrorBodyLimit says otherwise.
+const DefaultErrorBodyLimit = 64 << 10
+
+// ErrorBodyLimit keeps at most n bytes of non-2xx response bodies in the
+// returned APIError, marking longer ones as truncated. A negative n keeps
+// the whole body.
+func (a *Agent) ErrorBodyLimit(n int) *Agent {
+	a.errorBodyLimit = n
+	return a
+}
+
+func (a *Agent) newAPIError(resp *http.Response) *APIError {
+	limit := a.errorBodyLimit
+	if limit == 0 {
+		limit = DefaultErrorBodyLimit
+	}
+	var body []byte
+	if limit < 0 {
+		body, _ = ioutil.ReadAll(resp.Body)
+	} else {
+		body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+		if len(body) > limit {
+			body = append(body[:limit], "…truncated"...)
+		}
+	}
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}
+}
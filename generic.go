@@ -0,0 +1,14 @@
+package api
+
+import "context"
+
+// DoInto sends the request and decodes a JSON response into a new T.
+func DoInto[T any](a *Agent) (T, int, error) {
+	return ContextDoInto[T](a.context(), a)
+}
+
+func ContextDoInto[T any](ctx context.Context, a *Agent) (T, int, error) {
+	var v T
+	code, err := a.ContextJSON(ctx, &v)
+	return v, code, err
+}
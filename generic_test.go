@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDoInto(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":3,"name":"api"}`))
+	}))
+	defer srv.Close()
+
+	type Item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	item, code, err := DoInto[Item](Get(srv.URL))
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("DoInto failed: %d, %v", code, err)
+	}
+	if item.ID != 3 || item.Name != "api" {
+		t.Errorf("got %+v", item)
+	}
+
+	m, _, err := DoInto[map[string]interface{}](Get(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["name"] != "api" || m["id"] != float64(3) {
+		t.Errorf("got %v", m)
+	}
+}
@@ -1,6 +1,19 @@
 module github.com/liujianping/api
 
+go 1.18
+
 require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/golang/protobuf v1.2.0
-	golang.org/x/sync v0.0.0-20190412183630-56d357773e84 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/sync v0.0.0-20190412183630-56d357773e84
+	golang.org/x/text v0.14.0
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 )
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// JSONP decodes a response of the form callback(...json...) into obj. With
+// an empty callback the leading function name is accepted whatever it is.
+func (a *Agent) JSONP(callback string, obj interface{}) (int, error) {
+	return a.ContextJSONP(a.context(), callback, obj)
+}
+
+func (a *Agent) ContextJSONP(ctx context.Context, callback string, obj interface{}) (int, error) {
+	resp, err := a.Do(withAccept(ctx, "application/javascript"))
+	if err != nil {
+		a.Error = err
+		return http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return resp.StatusCode, a.Error
+	}
+
+	if obj != nil && resp.StatusCode != http.StatusNoContent {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			a.Error = err
+			return resp.StatusCode, err
+		}
+		inner, err := unwrapJSONP(body, callback)
+		if err != nil {
+			a.Error = err
+			return resp.StatusCode, err
+		}
+		if err := a.decodeJSON(bytes.NewReader(inner), &obj); err != nil {
+			a.Error = err
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, a.Error
+}
+
+func unwrapJSONP(body []byte, callback string) ([]byte, error) {
+	body = bytes.TrimSpace(body)
+	//! some servers prefix an empty comment against content sniffing
+	body = bytes.TrimSpace(bytes.TrimPrefix(body, []byte("/**/")))
+
+	open := bytes.IndexByte(body, '(')
+	if open < 0 {
+		return nil, errors.New("api: jsonp callback not found")
+	}
+	name := string(bytes.TrimSpace(body[:open]))
+	if callback != "" && name != callback {
+		return nil, fmt.Errorf("api: jsonp callback %q, want %q", name, callback)
+	}
+	if callback == "" && !isCallbackName(name) {
+		return nil, fmt.Errorf("api: invalid jsonp callback %q", name)
+	}
+
+	inner := bytes.TrimRight(body[open+1:], " \t\r\n;")
+	if !bytes.HasSuffix(inner, []byte(")")) {
+		return nil, fmt.Errorf("api: unterminated jsonp callback %q", name)
+	}
+	return inner[:len(inner)-1], nil
+}
+
+func isCallbackName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c == '$' || c == '.' ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte("/**/ " + r.URL.Query().Get("callback") + `({"name":"api","tags":["a","b"]});` + "\n"))
+	}))
+	defer srv.Close()
+
+	type payload struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	for _, callback := range []string{"jQuery_123", ""} {
+		var out payload
+		code, err := Get(srv.URL).QuerySet("callback", "jQuery_123").JSONP(callback, &out)
+		if err != nil {
+			t.Fatalf("%q: %d, %v", callback, code, err)
+		}
+		if out.Name != "api" || len(out.Tags) != 2 {
+			t.Errorf("%q: got %+v", callback, out)
+		}
+	}
+
+	var out payload
+	if _, err := Get(srv.URL).QuerySet("callback", "other").JSONP("jQuery_123", &out); err == nil {
+		t.Error("expected callback mismatch error")
+	}
+}
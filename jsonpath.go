@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPath decodes the JSON response body and returns the value at path, a
+// dotted path of object keys and array indexes such as data.items.0.id or
+// data.items[0].id. An empty path returns the whole document.
+func (a *Agent) JSONPath(path string) (int, interface{}, error) {
+	return a.ContextJSONPath(a.context(), path)
+}
+
+func (a *Agent) ContextJSONPath(ctx context.Context, path string) (int, interface{}, error) {
+	var doc interface{}
+	code, err := a.ContextJSON(ctx, &doc)
+	if err != nil {
+		return code, nil, err
+	}
+	value, err := walkJSONPath(doc, path)
+	if err != nil {
+		a.Error = err
+		return code, nil, err
+	}
+	return code, value, nil
+}
+
+func splitJSONPath(path string) []string {
+	//! items[0] is items.0
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	segments := []string{}
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func walkJSONPath(doc interface{}, path string) (interface{}, error) {
+	value := doc
+	segments := splitJSONPath(path)
+	for i, segment := range segments {
+		at := strings.Join(segments[:i+1], ".")
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[segment]
+			if !ok {
+				return nil, fmt.Errorf("api: json path %q: no key %q", at, segment)
+			}
+			value = next
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, fmt.Errorf("api: json path %q: %q is not an array index", at, segment)
+			}
+			if idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("api: json path %q: index %d out of range [0,%d)", at, idx, len(v))
+			}
+			value = v[idx]
+		default:
+			return nil, fmt.Errorf("api: json path %q: cannot index %T", at, value)
+		}
+	}
+	return value, nil
+}
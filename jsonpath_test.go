@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"total":2,"items":[{"id":"a","tags":["x"]},{"id":"b","tags":["y","z"]}]}}`))
+	}))
+	defer srv.Close()
+
+	for path, want := range map[string]interface{}{
+		"data.total":            float64(2),
+		"data.items.0.id":       "a",
+		"data.items[1].id":      "b",
+		"data.items.1.tags.1":   "z",
+		"data.items[1].tags[0]": "y",
+	} {
+		code, got, err := Get(srv.URL).JSONPath(path)
+		if err != nil || code != http.StatusOK {
+			t.Fatalf("%s: %d, %v", path, code, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+
+	for _, path := range []string{"data.missing", "data.items.2", "data.items.first", "data.total.x"} {
+		agent := Get(srv.URL)
+		if _, got, err := agent.JSONPath(path); err == nil || agent.Error == nil {
+			t.Errorf("%s: expected error, got %v", path, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import "net/http"
+
+// RoundTripFunc adapts a function to http.RoundTripper.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the round trip of every request sent by the transport.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use appends middlewares around the client transport. The first one
+// registered is the outermost, it sees the request first and the response
+// last.
+func (a *Agent) Use(mw ...Middleware) *Agent {
+	a.middlewares = append(a.middlewares, mw...)
+	return a
+}
+
+func (a *Agent) httpClient() *http.Client {
+	if len(a.middlewares) == 0 {
+		return a.client
+	}
+	transport := a.client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	next := RoundTripFunc(transport.RoundTrip)
+	for i := len(a.middlewares) - 1; i >= 0; i-- {
+		next = a.middlewares[i](next)
+	}
+	client := a.cloneClient()
+	client.Transport = next
+	return client
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(r.Header["X-Chain"], ",")))
+	}))
+	defer srv.Close()
+
+	var order []string
+	chain := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+">")
+				req.Header.Add("X-Chain", name)
+				resp, err := next(req)
+				order = append(order, "<"+name)
+				return resp, err
+			}
+		}
+	}
+
+	_, text, err := Get(srv.URL).Use(chain("outer"), chain("inner")).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "outer,inner" {
+		t.Errorf("transport saw headers %q", text)
+	}
+	if got := strings.Join(order, " "); got != "outer> inner> <inner <outer" {
+		t.Errorf("got call order %q", got)
+	}
+}
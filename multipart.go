@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+type formField struct {
+	name  string
+	value string
+	file  *File
+}
+
+// FormField adds a regular multipart form field, sent before the files of
+// FileData in the order the fields were added.
+func (a *Agent) FormField(name, value string) *Agent {
+	a.fields = append(a.fields, formField{name: name, value: value})
+	a.t = "multipart"
+	return a
+}
+
+// MultipartField adds a multipart form field. Fields and files added with
+// MultipartField, MultipartFile and FormField are written in insertion
+// order, before the files of FileData, for APIs that expect, say, a
+// signature field ahead of the file it signs.
+func (a *Agent) MultipartField(name, value string) *Agent {
+	return a.FormField(name, value)
+}
+
+// MultipartFile adds a multipart file in insertion order with the fields of
+// MultipartField, see there.
+func (a *Agent) MultipartFile(file *File) *Agent {
+	a.fields = append(a.fields, formField{name: file.Fieldname, file: file})
+	a.t = "multipart"
+	return a
+}
+
+// DetectFileType sniffs the Content-Type of multipart files that have no
+// ContentType set from their first 512 bytes, instead of sending them as
+// application/octet-stream.
+func (a *Agent) DetectFileType() *Agent {
+	a.detectFileType = true
+	return a
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func createFilePart(mw *multipart.Writer, file *File, detect bool) (io.Writer, io.Reader, error) {
+	var rd io.Reader = bytes.NewReader(file.Data)
+	if file.Reader != nil {
+		rd = file.Reader
+	}
+	content_type := file.ContentType
+	if content_type == "" && detect {
+		//! sniff the head of the file, then put it back in front of the rest
+		head := make([]byte, 512)
+		n, err := io.ReadFull(rd, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, nil, err
+		}
+		head = head[:n]
+		content_type = http.DetectContentType(head)
+		rd = io.MultiReader(bytes.NewReader(head), rd)
+	}
+	if content_type == "" {
+		fw, err := mw.CreateFormFile(file.Fieldname, file.Filename)
+		return fw, rd, err
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(file.Fieldname), quoteEscaper.Replace(file.Filename)))
+	h.Set("Content-Type", content_type)
+	fw, err := mw.CreatePart(h)
+	return fw, rd, err
+}
+
+func isStreaming(fields []formField, files []*File) bool {
+	for _, field := range fields {
+		if field.file != nil && field.file.Reader != nil {
+			return true
+		}
+	}
+	for _, file := range files {
+		if file.Reader != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFilePart(mw *multipart.Writer, file *File, detect bool) error {
+	fw, rd, err := createFilePart(mw, file, detect)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, rd)
+	return err
+}
+
+func writeMultipart(mw *multipart.Writer, fields []formField, files []*File, detect bool) error {
+	for _, field := range fields {
+		if field.file != nil {
+			if err := writeFilePart(mw, field.file, detect); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mw.WriteField(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if err := writeFilePart(mw, file, detect); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
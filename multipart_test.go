@@ -0,0 +1,292 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+type patternReader struct {
+	remaining int64
+	read      int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	for i := range p {
+		p[i] = byte('a' + (r.read+int64(i))%26)
+	}
+	r.remaining -= int64(len(p))
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestFileStream(t *testing.T) {
+	const size = 32 << 20
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n, _ := io.Copy(ioutil.Discard, part)
+		fmt.Fprintf(w, "%s:%s:%d:%d", part.FormName(), part.FileName(), n, r.ContentLength)
+	}))
+	defer srv.Close()
+
+	rd := &patternReader{remaining: size}
+	file, _ := NewFileStream("file", "/tmp/big.bin", rd)
+
+	var uploaded int64
+	code, text, err := Post(srv.URL).FileData(file).UploadProgress(func(written, total int64) {
+		if total != -1 {
+			t.Errorf("streamed upload total %d, want -1", total)
+		}
+		uploaded = written
+	}).Text()
+	if err != nil {
+		t.Fatalf("stream upload failed: %d, %v", code, err)
+	}
+	if want := fmt.Sprintf("file:big.bin:%d:-1", size); text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+	if rd.read != size || uploaded <= size {
+		t.Errorf("read %d bytes, uploaded %d", rd.read, uploaded)
+	}
+}
+
+func TestFormField(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(part)
+			fmt.Fprintf(w, "%s:%s=%s;", part.FormName(), part.FileName(), data)
+		}
+	}))
+	defer srv.Close()
+
+	file, _ := NewFileByBytes("file", "photo.png", []byte("png-data"))
+	_, text, err := Post(srv.URL).FileData(file).
+		FormField("key", "uploads/photo.png").
+		FormField("policy", "eyJ...").
+		FormField("key", "again").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "key:=uploads/photo.png;policy:=eyJ...;key:=again;file:photo.png=png-data;"
+	if text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestFileContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(part)
+			fmt.Fprintf(w, "%s:%s:%d;", part.FileName(), part.Header.Get("Content-Type"), len(data))
+		}
+	}))
+	defer srv.Close()
+
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	typed, _ := NewFileByBytes("file", "a.png", png)
+	typed.ContentType = "image/png"
+	plain, _ := NewFileByBytes("file", "b.png", png)
+	_, text, err := Post(srv.URL).FileData(typed, plain).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a.png:image/png:12;b.png:application/octet-stream:12;"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	sniffed, _ := NewFileStream("file", "c.png", bytes.NewReader(png))
+	_, text, err = Post(srv.URL).FileData(sniffed).DetectFileType().Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "c.png:image/png:12;"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(part)
+			fmt.Fprintf(w, "%s:%s=%s;", part.FormName(), part.FileName(), data)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("beta"), 0644)
+
+	_, text, err := Post(srv.URL).Files(map[string]string{
+		"second": filepath.Join(dir, "b.txt"),
+		"first":  filepath.Join(dir, "a.txt"),
+	}).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first:a.txt=alpha;second:b.txt=beta;"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	missing := filepath.Join(dir, "missing.txt")
+	_, _, err = Post(srv.URL).Files(map[string]string{"doc": missing}).Text()
+	if err == nil || !strings.Contains(err.Error(), `"doc"`) || !strings.Contains(err.Error(), missing) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMultipartOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var names []string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(part)
+			names = append(names, part.FormName()+"="+string(body))
+		}
+		w.Write([]byte(strings.Join(names, "&")))
+	}))
+	defer srv.Close()
+
+	first := &File{Fieldname: "first", Filename: "a.txt", Data: []byte("A")}
+	second, _ := NewFileStream("second", "b.txt", strings.NewReader("B"))
+	last := &File{Fieldname: "last", Filename: "c.txt", Data: []byte("C")}
+
+	for name, agent := range map[string]*Agent{
+		"buffered": Post(srv.URL).FileData(last).MultipartField("sig", "x").MultipartFile(first).MultipartField("note", "y"),
+		"streamed": Post(srv.URL).FileData(last).MultipartFile(second).MultipartField("sig", "x"),
+	} {
+		_, text, err := agent.Text()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := "sig=x&first=A&note=y&last=C"
+		if name == "streamed" {
+			want = "second=B&sig=x&last=C"
+		}
+		if text != want {
+			t.Errorf("%s: got %q, want %q", name, text, want)
+		}
+	}
+}
+
+func TestStreamingBodyClosedOnError(t *testing.T) {
+	failing := errors.New("rejected")
+	builds := map[string]func() *Agent{
+		"signed multipart": func() *Agent {
+			file, _ := NewFileStream("file", "a.txt", strings.NewReader("data"))
+			return Post("http://localhost").FileData(file).SignHMAC("id", "secret", "X-Signature")
+		},
+		"signed compressed stream": func() *Agent {
+			return Post("http://localhost").Stream(strings.NewReader(strings.Repeat("x", 1<<20))).
+				CompressRequest("gzip").SignHMAC("id", "secret", "X-Signature")
+		},
+		"url processor": func() *Agent {
+			file, _ := NewFileStream("file", "a.txt", strings.NewReader("data"))
+			return Post("http://localhost").FileData(file).URLProcessor(func(*url.URL) error { return failing })
+		},
+	}
+	for name, build := range builds {
+		before := runtime.NumGoroutine()
+		for i := 0; i < 20; i++ {
+			if _, err := build().Request(context.Background()); err == nil {
+				t.Fatalf("%s: expected error", name)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		if n := runtime.NumGoroutine() - before; n > 2 {
+			t.Errorf("%s: %d goroutines leaked", name, n)
+		}
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		file, _ := NewFileStream("file", "a.txt", strings.NewReader("data"))
+		agent := Post("http://localhost").FileData(file).RequestProcessor(func(r *http.Request) (*http.Request, RequestProcessorDeferHandler, error) {
+			return nil, nil, failing
+		})
+		if _, err := agent.Do(context.Background()); !errors.Is(err, failing) {
+			t.Fatalf("request processor: got %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := runtime.NumGoroutine() - before; n > 2 {
+		t.Errorf("request processor: %d goroutines leaked", n)
+	}
+}
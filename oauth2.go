@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2ClientCredentials authorizes every request with a bearer token of
+// the OAuth2 client credentials grant, fetched from tokenURL with the
+// client ID and secret when the request is sent; Request and Curl do not
+// fetch it. The token is cached and fetched again shortly before it
+// expires. Clones share the token of their template.
+func (a *Agent) OAuth2ClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *Agent {
+	a.oauth2 = &oauth2Source{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+	}
+	return a
+}
+
+// oauth2ExpiryDelta is how long before its expiry a token is renewed.
+const oauth2ExpiryDelta = 10 * time.Second
+
+type oauth2Source struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+func (s *oauth2Source) token(ctx context.Context, client *http.Client) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && (s.expiry.IsZero() || now().Before(s.expiry.Add(-oauth2ExpiryDelta))) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+	var success struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	var failure struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	agent := Post(s.tokenURL).SetClient(client).
+		BasicAuthHeader(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret)).
+		FormData(form)
+	code, err := agent.ContextJSONError(ctx, &success, &failure)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("api: oauth2 token: %w", err)
+	case !agent.expected(code) && failure.Error != "":
+		if failure.ErrorDescription != "" {
+			return "", fmt.Errorf("api: oauth2 token: %d %s: %s", code, failure.Error, failure.ErrorDescription)
+		}
+		return "", fmt.Errorf("api: oauth2 token: %d %s", code, failure.Error)
+	case !agent.expected(code):
+		return "", fmt.Errorf("api: oauth2 token: %d %s", code, http.StatusText(code))
+	case success.AccessToken == "":
+		return "", errors.New("api: oauth2 token: no access_token in response")
+	case success.TokenType != "" && !strings.EqualFold(success.TokenType, "bearer"):
+		return "", fmt.Errorf("api: oauth2 token: unsupported token type %q", success.TokenType)
+	}
+
+	s.accessToken = success.AccessToken
+	s.expiry = time.Time{}
+	if success.ExpiresIn > 0 {
+		s.expiry = now().Add(time.Duration(success.ExpiresIn) * time.Second)
+	}
+	return s.accessToken, nil
+}
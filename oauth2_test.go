@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	var issued int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			user, pass, _ := r.BasicAuth()
+			if r.FormValue("grant_type") != "client_credentials" || user != "id" || pass != "secret" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+				return
+			}
+			n := atomic.AddInt32(&issued, 1)
+			fmt.Fprintf(w, `{"access_token":"token-%d-%s","token_type":"Bearer","expires_in":3600}`,
+				n, strings.Replace(r.FormValue("scope"), " ", "+", -1))
+		case "/resource":
+			w.Write([]byte(r.Header.Get("Authorization")))
+		}
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).URI("/resource").OAuth2ClientCredentials(srv.URL+"/token", "id", "secret", "read", "write")
+	for i := 0; i < 3; i++ {
+		_, text, err := base.Clone().Text()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != "Bearer token-1-read+write" {
+			t.Errorf("request %d: got %q", i, text)
+		}
+	}
+
+	clock = clock.Add(time.Hour - oauth2ExpiryDelta)
+	if _, text, err := base.Clone().Text(); err != nil || text != "Bearer token-2-read+write" {
+		t.Errorf("after expiry: %q, %v", text, err)
+	}
+	if n := atomic.LoadInt32(&issued); n != 2 {
+		t.Errorf("issued %d tokens, want 2", n)
+	}
+
+	//! building or rendering the request does not fetch a token
+	agent := Get(srv.URL).URI("/resource").OAuth2ClientCredentials(srv.URL+"/token", "id", "secret")
+	if _, err := agent.Request(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := agent.Curl(true)
+	if err != nil || !strings.Contains(cmd, "-H 'Authorization: Bearer <oauth2 token>'") {
+		t.Errorf("curl: %s, %v", cmd, err)
+	}
+	if n := atomic.LoadInt32(&issued); n != 2 {
+		t.Errorf("issued %d tokens without sending, want 2", n)
+	}
+
+	_, _, err = Get(srv.URL).URI("/resource").OAuth2ClientCredentials(srv.URL+"/token", "id", "wrong").Text()
+	if err == nil || !strings.Contains(err.Error(), "invalid_client: bad credentials") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Pages sends the request, then follows the rel="next" links of the Link
+// response header (RFC 5988), calling handler for every page until there is
+// no next link, handler fails or ctx is done. Each page is requested with
+// the agent's headers, cookies and auth; its body is closed after handler
+// returns.
+func (a *Agent) Pages(ctx context.Context, handler func(resp *http.Response) error) error {
+	agent := a
+	for {
+		resp, err := agent.Do(ctx)
+		if err != nil {
+			a.Error = err
+			return err
+		}
+		if !a.expected(resp.StatusCode) {
+			a.Error = a.newAPIError(resp)
+			resp.Body.Close()
+			return a.Error
+		}
+		next := nextLink(resp)
+		err = handler(resp)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		//! the next link carries its own query
+		agent = a.Clone()
+		if next.Host == a.u.Host {
+			next.User = a.u.User
+		}
+		agent.u = next
+		agent.query = url.Values{}
+	}
+}
+
+func nextLink(resp *http.Response) *url.URL {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(key, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						u, err := resp.Request.URL.Parse(target[1 : len(target)-1])
+						if err != nil {
+							return nil
+						}
+						return u
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
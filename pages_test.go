@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		switch page {
+		case "":
+			w.Header().Add("Link", `</items?page=2&per_page=1>; rel="next", </items?page=2&per_page=1>; rel="last"`)
+		case "2":
+			w.Header().Add("Link", `</items?per_page=1>; rel="first prev"`)
+		}
+		fmt.Fprintf(w, "page %s %s", page, r.URL.RawQuery)
+	}))
+	defer srv.Close()
+
+	var pages []string
+	err := Get(srv.URL).URI("/items").QuerySet("per_page", "1").BearerToken("token").
+		Pages(context.Background(), func(resp *http.Response) error {
+			body, err := ioutil.ReadAll(resp.Body)
+			pages = append(pages, string(body))
+			return err
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0] != "page  per_page=1" || pages[1] != "page 2 page=2&per_page=1" {
+		t.Errorf("got %q", pages)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err = Get(srv.URL).URI("/items").BearerToken("token").Pages(ctx, func(resp *http.Response) error {
+		calls++
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("got %v after %d pages", err, calls)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"io"
+	"net/http"
+)
+
+// ProgressFunc is called as a body is transferred with the number of bytes
+// written so far and the total size, or -1 when the size is unknown.
+type ProgressFunc func(written, total int64)
+
+// UploadProgress reports the progress of sending the request body, such as
+// a multipart file upload, to fn.
+func (a *Agent) UploadProgress(fn func(written, total int64)) *Agent {
+	a.uploadProgress = fn
+	return a
+}
+
+type progressReader struct {
+	io.ReadCloser
+	written int64
+	total   int64
+	fn      ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.written += int64(n)
+		r.fn(r.written, r.total)
+	}
+	return n, err
+}
+
+func trackUpload(req *http.Request, fn ProgressFunc) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	total := req.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	req.Body = &progressReader{ReadCloser: req.Body, total: total, fn: fn}
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return &progressReader{ReadCloser: body, total: total, fn: fn}, nil
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fd, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer fd.Close()
+		data, _ := ioutil.ReadAll(fd)
+		w.Write(data[:16])
+	}))
+	defer srv.Close()
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64<<10)
+	file, _ := NewFileByBytes("file", "payload.bin", payload)
+
+	var calls int
+	var last, total int64
+	progress := func(written, size int64) {
+		if written <= last {
+			t.Errorf("written not increasing: %d after %d", written, last)
+		}
+		calls++
+		last, total = written, size
+	}
+
+	code, text, err := Post(srv.URL).FileData(file).UploadProgress(progress).Text()
+	if err != nil {
+		t.Fatalf("upload failed: %d, %v", code, err)
+	}
+	if text != "0123456789abcdef" {
+		t.Errorf("got %q", text)
+	}
+	if calls < 2 {
+		t.Errorf("progress called %d times", calls)
+	}
+	if total <= int64(len(payload)) || last != total {
+		t.Errorf("finished at %d of %d, payload %d", last, total, len(payload))
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// Propagator injects values carried by the request context, such as a trace
+// context, into the request headers.
+type Propagator interface {
+	Inject(ctx context.Context, header http.Header)
+}
+
+// PropagatorFunc adapts a function to Propagator.
+type PropagatorFunc func(ctx context.Context, header http.Header)
+
+func (f PropagatorFunc) Inject(ctx context.Context, header http.Header) {
+	f(ctx, header)
+}
+
+// Propagate adds a propagator run on the context of every request, so an
+// OpenTelemetry propagator can be plugged in through PropagatorFunc.
+func (a *Agent) Propagate(propagator Propagator) *Agent {
+	a.propagators = append(a.propagators, propagator)
+	return a
+}
+
+// TraceParent is a W3C trace context, see https://www.w3.org/TR/trace-context/.
+// TraceID and SpanID are lowercase hex, 32 and 16 digits long.
+type TraceParent struct {
+	TraceID    string
+	SpanID     string
+	Sampled    bool
+	TraceState string
+}
+
+type traceParentKey struct{}
+
+// WithTraceParent returns a copy of ctx carrying tp for W3CTraceContext.
+func WithTraceParent(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, tp)
+}
+
+// W3CTraceContext sets the traceparent and tracestate headers from the
+// TraceParent of the request context, if any.
+var W3CTraceContext Propagator = PropagatorFunc(func(ctx context.Context, header http.Header) {
+	tp, ok := ctx.Value(traceParentKey{}).(TraceParent)
+	if !ok || len(tp.TraceID) != 32 || len(tp.SpanID) != 16 {
+		return
+	}
+	flags := "00"
+	if tp.Sampled {
+		flags = "01"
+	}
+	header.Set("traceparent", "00-"+tp.TraceID+"-"+tp.SpanID+"-"+flags)
+	if tp.TraceState != "" {
+		header.Set("tracestate", tp.TraceState)
+	}
+})
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type tenantKey struct{}
+
+func TestPropagate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("traceparent") + "|" + r.Header.Get("tracestate") + "|" + r.Header.Get("X-Tenant")))
+	}))
+	defer srv.Close()
+
+	tenant := PropagatorFunc(func(ctx context.Context, header http.Header) {
+		if v, ok := ctx.Value(tenantKey{}).(string); ok {
+			header.Set("X-Tenant", v)
+		}
+	})
+
+	ctx := WithTraceParent(context.WithValue(context.Background(), tenantKey{}, "acme"), TraceParent{
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:     "00f067aa0ba902b7",
+		Sampled:    true,
+		TraceState: "vendor=value",
+	})
+	_, text, err := Get(srv.URL).Propagate(W3CTraceContext).Propagate(tenant).ContextText(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01|vendor=value|acme"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	_, text, _ = Get(srv.URL).Propagate(W3CTraceContext).Text()
+	if text != "||" {
+		t.Errorf("got %q without trace context", text)
+	}
+}
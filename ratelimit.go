@@ -0,0 +1,22 @@
+package api
+
+import "golang.org/x/time/rate"
+
+// RateLimit throttles the agent to r requests per second with bursts of
+// up to burst requests. Clones share the limiter of their template.
+func (a *Agent) RateLimit(r rate.Limit, burst int) *Agent {
+	a.limiter = rate.NewLimiter(r, burst)
+	return a
+}
+
+// RateLimiter throttles the agent with l, which may be shared by several
+// agents.
+func (a *Agent) RateLimiter(l *rate.Limiter) *Agent {
+	a.limiter = l
+	return a
+}
+
+// GetRateLimiter returns the limiter installed by RateLimit or RateLimiter.
+func (a *Agent) GetRateLimiter() *rate.Limiter {
+	return a.limiter
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	base := Get(srv.URL).RateLimit(rate.Every(50*time.Millisecond), 1)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, _, err := base.Clone().Status(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("5 requests took %s, want at least 200ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+	_, _, err := Get(srv.URL).RateLimiter(limiter).Context(ctx).Status()
+	if err == nil {
+		t.Error("expected the limiter wait to fail with the request context")
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// WithRequestID sets a random UUID in the given header, X-Request-ID by
+// default, of every request that does not have one yet. RequestID returns
+// the ID of the last request built.
+func (a *Agent) WithRequestID(header string) *Agent {
+	if header == "" {
+		header = "X-Request-ID"
+	}
+	a.requestIDHeader = header
+	return a
+}
+
+// RequestID returns the request ID of the last request built by the agent.
+func (a *Agent) RequestID() string {
+	return a.requestID
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Request-ID") + "|" + r.Header.Get("X-Correlation-ID")))
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).WithRequestID("")
+	_, text, err := agent.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := agent.RequestID()
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("got request id %q", id)
+	}
+	if text != id+"|" {
+		t.Errorf("server saw %q, want %q", text, id)
+	}
+
+	agent = Get(srv.URL).HeadSet("X-Correlation-ID", "given").WithRequestID("X-Correlation-ID")
+	if _, text, _ = agent.Text(); text != "|given" || agent.RequestID() != "given" {
+		t.Errorf("got %q, request id %q", text, agent.RequestID())
+	}
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backoff returns how long to wait before the given retry attempt,
+// attempts are numbered from 1.
+type Backoff func(attempt int) time.Duration
+
+// ExponentialBackoff doubles the wait from base on every attempt up to max,
+// picking a random duration in the upper half of it to spread out clients.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		if d <= 0 {
+			return 0
+		}
+		half := d / 2
+		return half + time.Duration(rand.Int63n(int64(d-half)+1))
+	}
+}
+
+var DefaultBackoff = ExponentialBackoff(100*time.Millisecond, 5*time.Second)
+
+// RetryOn retries the request up to max times when the transport fails or
+// the response status is one of codes.
+func (a *Agent) RetryOn(max int, codes ...int) *Agent {
+	a.retryMax = max
+	a.retryCodes = codes
+	return a
+}
+
+// RetryBudget caps the total time spent on a request and its retries,
+// backoff included, reading the response body included. No retry is started
+// that would begin after d, or after the deadline of the request context,
+// and the last response is returned then. An attempt still running at d is
+// cut off with an error wrapping context.DeadlineExceeded.
+func (a *Agent) RetryBudget(d time.Duration) *Agent {
+	a.retryBudget = d
+	return a
+}
+
+// RetryBackoff replaces DefaultBackoff for waits between retries.
+func (a *Agent) RetryBackoff(backoff Backoff) *Agent {
+	a.backoff = backoff
+	return a
+}
+
+// retryAfter parses the Retry-After header of 429 and 503 responses, given
+// either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil ||
+		(resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now()); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (a *Agent) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil &&
+			!errors.Is(err, ErrTooManyRedirects) && !errors.Is(err, ErrCircuitOpen)
+	}
+	for _, code := range a.retryCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Agent) transmit(req *http.Request) (*http.Response, error) {
+	client := a.httpClient()
+	parent := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if a.retryBudget > 0 {
+		//! the budget bounds the attempts themselves, not only the waits
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(parent, a.retryBudget)
+		req = req.WithContext(ctx)
+	}
+	deadline, bounded := req.Context().Deadline()
+	resp, err := a.transmitAttempts(client, req, deadline, bounded)
+	if err != nil || resp == nil {
+		cancel()
+		if a.retryBudget > 0 && errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+			err = fmt.Errorf("api: retry budget of %s exceeded: %w", a.retryBudget, err)
+		}
+		return resp, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (a *Agent) transmitAttempts(client *http.Client, req *http.Request, deadline time.Time, bounded bool) (*http.Response, error) {
+	var stale *cacheEntry
+	if a.cache != nil {
+		var resp *http.Response
+		if resp, stale = a.cache.lookup(req); resp != nil {
+			a.fromCache = true
+			return resp, nil
+		}
+	}
+
+	resp, err := a.roundTrip(client, req)
+	for attempt := 1; attempt <= a.retryMax && a.retryable(req, resp, err); attempt++ {
+		if req.Body != nil && req.GetBody == nil {
+			break
+		}
+
+		backoff := a.backoff
+		if backoff == nil {
+			backoff = DefaultBackoff
+		}
+		wait := backoff(attempt)
+		if d, ok := retryAfter(resp); ok {
+			wait = d
+		}
+		if bounded && time.Now().Add(wait).After(deadline) {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		next := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return nil, berr
+			}
+			next.Body = body
+		}
+		req = next
+		resp, err = a.roundTrip(client, req)
+	}
+
+	if a.cache != nil && err == nil {
+		if stale != nil && resp.StatusCode == http.StatusNotModified {
+			return a.cache.revalidated(req, resp, stale)
+		}
+		return a.cache.save(req, resp)
+	}
+	return resp, err
+}
+
+func (a *Agent) roundTrip(client *http.Client, req *http.Request) (*http.Response, error) {
+	if a.limiter != nil {
+		if err := a.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	if a.breaker != nil {
+		if err := a.breaker.allow(req.URL.Host); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.Do(req)
+	if err == nil && a.digest != nil {
+		resp, err = a.digest.authenticate(client, req, resp)
+	}
+	if a.breaker != nil {
+		a.breaker.record(req.URL.Host, err != nil || resp.StatusCode >= 500)
+	}
+	return resp, err
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func noBackoff(int) time.Duration { return 0 }
+
+func TestRetryOn(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != `{"a":1}` {
+			t.Errorf("attempt %d got body %q", atomic.LoadInt32(&attempts)+1, body)
+		}
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	code, text, err := Post(srv.URL).JSONData(map[string]int{"a": 1}).
+		RetryOn(5, http.StatusBadGateway, http.StatusServiceUnavailable).
+		RetryBackoff(noBackoff).Text()
+	if err != nil {
+		t.Fatalf("retry failed: %d, %v", code, err)
+	}
+	if text != "ok" || attempts != 3 {
+		t.Errorf("got %q after %d attempts, want ok after 3", text, attempts)
+	}
+}
+
+func TestRetryOnExhausted(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	code, _, _ := Get(srv.URL).RetryOn(2, http.StatusBadGateway).RetryBackoff(noBackoff).Status()
+	if code != http.StatusBadGateway {
+		t.Errorf("got status %d, want %d", code, http.StatusBadGateway)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 40*time.Millisecond)
+	for attempt, max := range []time.Duration{10, 20, 40, 40} {
+		max *= time.Millisecond
+		if d := backoff(attempt + 1); d < max/2 || d > max {
+			t.Errorf("attempt %d: backoff %s out of [%s, %s]", attempt+1, d, max/2, max)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	cases := []struct {
+		code  int
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{http.StatusTooManyRequests, "3", 3 * time.Second, true},
+		{http.StatusServiceUnavailable, "Mon, 01 Jan 2024 12:00:05 GMT", 5 * time.Second, true},
+		{http.StatusServiceUnavailable, "Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{http.StatusTooManyRequests, "soon", 0, false},
+		{http.StatusTooManyRequests, "", 0, false},
+		{http.StatusBadGateway, "3", 0, false},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.code, Header: http.Header{"Retry-After": {c.value}}}
+		wait, ok := retryAfter(resp)
+		if wait != c.wait || ok != c.ok {
+			t.Errorf("%d %q: got %s, %v, want %s, %v", c.code, c.value, wait, ok, c.wait, c.ok)
+		}
+	}
+}
+
+func TestRetryOnRetryAfter(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, text, err := Get(srv.URL).RetryOn(1, http.StatusTooManyRequests).RetryBackoff(noBackoff).Text()
+	if err != nil || text != "ok" {
+		t.Fatalf("got %q, %v", text, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want Retry-After of 1s", elapsed)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	code, _, err := Get(srv.URL).RetryOn(10, http.StatusServiceUnavailable).
+		RetryBackoff(func(int) time.Duration { return 20 * time.Millisecond }).
+		RetryBudget(250 * time.Millisecond).Status()
+	elapsed := time.Since(start)
+	//! the third attempt starts at 240ms and is cut off by the budget
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got status %d, %v, want the budget exceeded", code, err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+	if elapsed > 300*time.Millisecond {
+		t.Errorf("took %s, budget 250ms", elapsed)
+	}
+
+	//! a response within the budget is returned as is
+	atomic.StoreInt32(&attempts, 0)
+	code, _, err = Get(srv.URL).RetryOn(10, http.StatusServiceUnavailable).
+		RetryBackoff(func(int) time.Duration { return 200 * time.Millisecond }).
+		RetryBudget(250 * time.Millisecond).Status()
+	if n := atomic.LoadInt32(&attempts); code != http.StatusServiceUnavailable || n != 1 {
+		t.Errorf("got status %d after %d attempts, %v", code, n, err)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	Get(srv.URL).RetryOn(10, http.StatusServiceUnavailable).
+		RetryBackoff(func(int) time.Duration { return 100 * time.Millisecond }).ContextStatus(ctx)
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("got %d attempts, want the context deadline to stop retries", n)
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignHMAC(t *testing.T) {
+	now = func() time.Time { return time.Unix(1700000000, 0) }
+	defer func() { now = time.Now }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Signature") + "|" + r.Header.Get(TIMESTAMP_HEADER)))
+	}))
+	defer srv.Close()
+
+	code, text, err := Post(srv.URL).URI("/v1/pay").QuerySet("id", "7").
+		JSONData(map[string]int{"amount": 100}).
+		SignHMAC("key-1", "topsecret", "X-Signature").Text()
+	if err != nil {
+		t.Fatalf("signed request failed: %d, %v", code, err)
+	}
+
+	want := "key-1:81c87306e4b0e170c251b0a5cf1de937bd2376434c6e8717de4b97a72e715f9b|1700000000"
+	if text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAWSV4(t *testing.T) {
+	now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	const (
+		accessKey = "AKIDEXAMPLE"
+		secretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	)
+
+	//! get-vanilla and get-vanilla-query-order-key-case of the AWS SigV4 test suite
+	vectors := map[string]string{
+		"/":                             "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		"/?Param2=value2&Param1=value1": "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+	}
+	for uri, signature := range vectors {
+		req, _ := http.NewRequest(GET, "https://example.amazonaws.com"+uri, nil)
+		signer := &awsV4Signer{accessKey: accessKey, secretKey: secretKey, region: "us-east-1", service: "service"}
+		if err := signer.sign(req); err != nil {
+			t.Fatal(err)
+		}
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+			"SignedHeaders=host;x-amz-date, Signature=" + signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: got %q, want %q", uri, got, want)
+		}
+		if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+			t.Errorf("%s: X-Amz-Date %q", uri, got)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("X-Amz-Content-Sha256")))
+	}))
+	defer srv.Close()
+
+	_, text, err := Put(srv.URL).URI("/bucket/key").RawData("text/plain", []byte("hello")).
+		SignAWSV4(accessKey, secretKey, "us-east-1", "s3").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/s3/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=") ||
+		!strings.HasSuffix(text, "|2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824") {
+		t.Errorf("got %q", text)
+	}
+
+	if _, _, err := Post(srv.URL).Stream(&patternReader{remaining: 1}).SignAWSV4(accessKey, secretKey, "us-east-1", "s3").Text(); err == nil {
+		t.Error("expected error signing a streaming body")
+	}
+}
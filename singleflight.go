@@ -0,0 +1,49 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httputil"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleFlight collapses concurrent identical GET and HEAD requests sharing
+// group into a single round trip; every caller gets its own copy of the
+// buffered response. Requests are identical when their method, URL and
+// headers match, but for the request ID of WithRequestID and the
+// traceparent and tracestate trace context. The first caller's context
+// governs the shared round trip.
+func (a *Agent) SingleFlight(group *singleflight.Group) *Agent {
+	a.group = group
+	return a
+}
+
+func (a *Agent) send(req *http.Request) (*http.Response, error) {
+	if a.group == nil || (req.Method != GET && req.Method != HEAD) ||
+		(req.Body != nil && req.Body != http.NoBody) {
+		return a.transmit(req)
+	}
+
+	//! per request identifiers would never match
+	exclude := map[string]bool{"Traceparent": true, "Tracestate": true}
+	if a.requestIDHeader != "" {
+		exclude[http.CanonicalHeaderKey(a.requestIDHeader)] = true
+	}
+	key := &bytes.Buffer{}
+	key.WriteString(req.Method + " " + req.URL.String() + "\n")
+	req.Header.WriteSubset(key, exclude)
+	v, err, _ := a.group.Do(key.String(), func() (interface{}, error) {
+		resp, err := a.transmit(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return httputil.DumpResponse(resp, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(v.([]byte))), req)
+}
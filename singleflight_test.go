@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+func TestSingleFlight(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("X-Shared", "yes")
+		w.Write([]byte("slow response"))
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).URI("/slow").SingleFlight(&singleflight.Group{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent := base.Clone()
+			_, text, err := agent.Text()
+			if err != nil || text != "slow response" || agent.GetHeadOut().Get("X-Shared") != "yes" {
+				t.Errorf("got %q, %v", text, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+
+	if _, _, err := base.Clone().Method(POST).Text(); err != nil || atomic.LoadInt32(&hits) != 2 {
+		t.Errorf("POST was collapsed: %d hits, %v", hits, err)
+	}
+}
+
+func TestSingleFlightHeaders(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		if r.Header.Get("Accept") == "application/xml" {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<item><id>2</id></item>`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":1,"tenant":%q}`, r.Header.Get("X-Tenant"))
+	}))
+	defer srv.Close()
+
+	base := Get(srv.URL).SingleFlight(&singleflight.Group{}).WithRequestID("")
+	type item struct {
+		ID     int    `json:"id" xml:"id"`
+		Tenant string `json:"tenant"`
+	}
+	var asJSON, asXML, asTenant, again item
+	var wg sync.WaitGroup
+	for _, fn := range []func(){
+		func() { base.Clone().JSON(&asJSON) },
+		func() { base.Clone().XML(&asXML) },
+		func() { base.Clone().HeadSet("X-Tenant", "b").JSON(&asTenant) },
+		func() { base.Clone().JSON(&again) },
+	} {
+		wg.Add(1)
+		go func(fn func()) {
+			defer wg.Done()
+			fn()
+		}(fn)
+	}
+	wg.Wait()
+	if asJSON.ID != 1 || again.ID != 1 || asXML.ID != 2 || asTenant.Tenant != "b" {
+		t.Errorf("got json %+v, xml %+v, tenant %+v, again %+v", asJSON, asXML, asTenant, again)
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("server saw %d requests, want 3", n)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a server-sent event.
+type Event struct {
+	Name  string
+	Data  string
+	ID    string
+	Retry time.Duration
+}
+
+// EventStream sends the request and reads the response as a
+// text/event-stream, calling handler for every event as it arrives. It
+// returns nil at the end of the stream, or the first error from handler,
+// reading the body or ctx.
+func (a *Agent) EventStream(ctx context.Context, handler func(Event) error) error {
+	resp, err := a.Do(withAccept(ctx, "text/event-stream"))
+	if err != nil {
+		a.Error = err
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return a.Error
+	}
+
+	if err := readEvents(resp.Body, handler); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		a.Error = err
+		return err
+	}
+	return nil
+}
+
+func readEvents(rd io.Reader, handler func(Event) error) error {
+	br := bufio.NewReader(rd)
+	var event Event
+	var data []string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			//! a blank line dispatches the pending event
+			if len(data) > 0 {
+				event.Data = strings.Join(data, "\n")
+				if err := handler(event); err != nil {
+					return err
+				}
+			}
+			event.Name, event.Data, event.Retry, data = "", "", 0, nil
+			if eof {
+				return nil
+			}
+			continue
+		}
+
+		field, value := line, ""
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			field, value = line[:idx], strings.TrimPrefix(line[idx+1:], " ")
+		}
+		switch field {
+		case "":
+			//! comment
+		case "event":
+			event.Name = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+
+		if eof {
+			//! an event without a trailing blank line is incomplete
+			return nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": keep-alive\n\nretry: 1500\n\n"))
+		w.Write([]byte("event: update\nid: 1\ndata: first line\ndata: second line\n\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("data:{\"n\":2}\r\nid: 2\r\n\r\n"))
+		w.Write([]byte("data: incomplete"))
+	}))
+	defer srv.Close()
+
+	var events []Event
+	err := Get(srv.URL).EventStream(context.Background(), func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{Name: "update", ID: "1", Data: "first line\nsecond line"},
+		{ID: "2", Data: `{"n":2}`},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v, want %+v", events, want)
+	}
+
+	stop := errors.New("stop")
+	err = Get(srv.URL).EventStream(context.Background(), func(e Event) error { return stop })
+	if err != stop {
+		t.Errorf("got %v, want handler error", err)
+	}
+}
+
+func TestEventStreamCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: hello\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var n int
+	err := Get(srv.URL).EventStream(ctx, func(e Event) error {
+		n++
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || n != 1 {
+		t.Errorf("got %d events, %v", n, err)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONStream sends the request and decodes the response as a stream of
+// JSON values, such as newline delimited JSON. Every value is decoded into
+// a fresh element from newElem and passed to handler. It returns nil at the
+// end of the stream, or the first error from handler, decoding or ctx.
+func (a *Agent) JSONStream(ctx context.Context, newElem func() interface{}, handler func(interface{}) error) error {
+	resp, err := a.Do(withAccept(ctx, "application/x-ndjson, application/json"))
+	if err != nil {
+		a.Error = err
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		a.Error = a.newAPIError(resp)
+		return a.Error
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		elem := newElem()
+		if err := dec.Decode(elem); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			a.Error = err
+			return err
+		}
+		if err := handler(elem); err != nil {
+			a.Error = err
+			return err
+		}
+	}
+}
+
+// JSONStreamData sends v as a JSON request body encoded on the fly by a
+// json.Encoder, without marshaling it in memory first. Like Stream, the body
+// is sent chunked, without Content-Length, and can be sent only once. A
+// JSONCodec is not used.
+func (a *Agent) JSONStreamData(v interface{}) *Agent {
+	pr, pw := io.Pipe()
+	a.Stream(&jsonStreamBody{v: v, pr: pr, pw: pw})
+	a.t = "json"
+	return a
+}
+
+// jsonStreamBody encodes v into a pipe once the request body is first read.
+// Closing it, as the transport does with an aborted request, stops the
+// encoder.
+type jsonStreamBody struct {
+	v    interface{}
+	once sync.Once
+	pr   *io.PipeReader
+	pw   *io.PipeWriter
+}
+
+func (b *jsonStreamBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		go func() {
+			b.pw.CloseWithError(json.NewEncoder(b.pw).Encode(b.v))
+		}()
+	})
+	return b.pr.Read(p)
+}
+
+func (b *jsonStreamBody) Close() error {
+	return b.pr.Close()
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONStream(t *testing.T) {
+	type Row struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for i := 0; i < 1000; i++ {
+			enc.Encode(Row{ID: i, Name: "row"})
+		}
+	}))
+	defer srv.Close()
+
+	var n int
+	err := Get(srv.URL).JSONStream(context.Background(),
+		func() interface{} { return &Row{} },
+		func(v interface{}) error {
+			row := v.(*Row)
+			if row.ID != n || row.Name != "row" {
+				t.Errorf("row %d: got %+v", n, row)
+			}
+			n++
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("decoded %d rows, want 1000", n)
+	}
+}
+
+func TestJSONStreamData(t *testing.T) {
+	type Row struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	rows := make([]Row, 20000)
+	for i := range rows {
+		rows[i] = Row{ID: i, Name: fmt.Sprintf("row-%d", i)}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got []Row
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%s %d %v %d %s", r.Header.Get("Content-Type"), r.ContentLength, r.TransferEncoding, len(got), got[len(got)-1].Name)
+	}))
+	defer srv.Close()
+
+	_, text, err := Post(srv.URL).JSONStreamData(rows).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "application/json -1 [chunked] 20000 row-19999"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	if _, _, err := Post(srv.URL).JSONStreamData(make(chan int)).Text(); err == nil {
+		t.Error("expected error for an unencodable value")
+	}
+}
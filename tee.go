@@ -0,0 +1,32 @@
+package api
+
+import "io"
+
+// TeeResponse copies the response body to w as it is read, after
+// decompression and decryption, for audit logs. w is flushed when the body
+// is closed if it has a Flush method. A body closed before its end, such as
+// an event stream, is copied only as far as it was read.
+func (a *Agent) TeeResponse(w io.Writer) *Agent {
+	a.tee = w
+	return a
+}
+
+type teeBody struct {
+	io.ReadCloser
+	r io.Reader
+	w io.Writer
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *teeBody) Close() error {
+	switch f := b.w.(type) {
+	case interface{ Flush() error }:
+		f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return b.ReadCloser.Close()
+}
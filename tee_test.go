@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTeeResponse(t *testing.T) {
+	const body = `{"id":1,"name":"api"}` + "\n\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	var audit bytes.Buffer
+	sink := bufio.NewWriterSize(&audit, 4096)
+	var out struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	if _, err := Get(srv.URL).TeeResponse(sink).JSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != 1 || out.Name != "api" {
+		t.Errorf("decoded %+v", out)
+	}
+	if audit.String() != body {
+		t.Errorf("audit got %q, want %q", audit.String(), body)
+	}
+}
+
+func TestTeeResponseEarlyClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; r.Context().Err() == nil; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	var audit bytes.Buffer
+	stop := errors.New("stop")
+	done := make(chan error, 1)
+	go func() {
+		done <- Get(srv.URL).TeeResponse(&audit).EventStream(context.Background(), func(e Event) error {
+			return stop
+		})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, stop) {
+			t.Errorf("got %v", err)
+		}
+		if !strings.HasPrefix(audit.String(), "data: 0\n") {
+			t.Errorf("audit got %q", audit.String())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("closing an endless teed body hangs")
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is the latency breakdown of the last traced request.
+type Timings struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+	Total        time.Duration
+}
+
+// Trace records Timings for the requests sent by the agent.
+func (a *Agent) Trace() *Agent {
+	a.tracer = &tracer{}
+	return a
+}
+
+// Timings returns the timings of the last request sent with Trace enabled.
+// Total covers reading the response body once it has been closed.
+func (a *Agent) Timings() Timings {
+	if a.tracer == nil {
+		return Timings{}
+	}
+	a.tracer.mu.Lock()
+	defer a.tracer.mu.Unlock()
+	return a.tracer.timings
+}
+
+type tracer struct {
+	mu      sync.Mutex
+	start   time.Time
+	dns     time.Time
+	connect time.Time
+	tls     time.Time
+	timings Timings
+}
+
+func (t *tracer) record(fn func(now time.Time)) {
+	t.mu.Lock()
+	fn(time.Now())
+	t.mu.Unlock()
+}
+
+func (t *tracer) context(ctx context.Context) context.Context {
+	t.record(func(now time.Time) {
+		t.start = now
+		t.timings = Timings{}
+	})
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(func(now time.Time) { t.dns = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(func(now time.Time) { t.timings.DNS = now.Sub(t.dns) })
+		},
+		ConnectStart: func(string, string) {
+			t.record(func(now time.Time) { t.connect = now })
+		},
+		ConnectDone: func(string, string, error) {
+			t.record(func(now time.Time) { t.timings.Connect = now.Sub(t.connect) })
+		},
+		TLSHandshakeStart: func() {
+			t.record(func(now time.Time) { t.tls = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(func(now time.Time) { t.timings.TLSHandshake = now.Sub(t.tls) })
+		},
+		GotFirstResponseByte: func() {
+			t.record(func(now time.Time) { t.timings.FirstByte = now.Sub(t.start) })
+		},
+	})
+}
+
+func (t *tracer) done() {
+	t.record(func(now time.Time) { t.timings.Total = now.Sub(t.start) })
+}
+
+// traceBody completes the total time once the body is closed
+type traceBody struct {
+	io.ReadCloser
+	tracer *tracer
+}
+
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.tracer.done()
+	return err
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("header"))
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).Trace()
+	if _, _, err := agent.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+
+	timings := agent.Timings()
+	if timings.FirstByte < 20*time.Millisecond {
+		t.Errorf("first byte %s, want at least 20ms", timings.FirstByte)
+	}
+	if timings.Total < timings.FirstByte+15*time.Millisecond {
+		t.Errorf("total %s does not cover body after first byte %s", timings.Total, timings.FirstByte)
+	}
+	if timings.Connect <= 0 || timings.Connect > timings.FirstByte {
+		t.Errorf("connect %s not within first byte %s", timings.Connect, timings.FirstByte)
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var defaultClient atomic.Value
+
+// SetDefaultClient sets the client of the agents created from then on, in
+// place of http.DefaultClient. A nil c restores http.DefaultClient.
+func SetDefaultClient(c *http.Client) {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	defaultClient.Store(c)
+}
+
+func getDefaultClient() *http.Client {
+	if c, ok := defaultClient.Load().(*http.Client); ok {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// DefaultTransport returns a new transport with the settings of
+// http.DefaultTransport and a larger idle connection pool per host, as a
+// starting point for SetDefaultClient.
+func DefaultTransport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.MaxIdleConnsPerHost = 32
+	return tr
+}
+
+// transport returns a copy of the client's *http.Transport to configure, so
+// the shared client and its transport are never mutated.
+func (a *Agent) transport() (*http.Transport, error) {
+	switch tr := a.client.Transport.(type) {
+	case nil:
+		return http.DefaultTransport.(*http.Transport).Clone(), nil
+	case *http.Transport:
+		return tr.Clone(), nil
+	default:
+		return nil, errors.New("api: transport is not an *http.Transport")
+	}
+}
+
+func (a *Agent) setTransport(tr *http.Transport) {
+	client := a.cloneClient()
+	client.Transport = tr
+	a.client = client
+}
+
+// Proxy sends the requests through the http, https or socks5 proxy at
+// proxyURL. An empty proxyURL disables any proxy, including the one from
+// the environment.
+func (a *Agent) Proxy(proxyURL string) *Agent {
+	tr, err := a.transport()
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	if proxyURL == "" {
+		tr.Proxy = nil
+		a.setTransport(tr)
+		return a
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		a.Error = fmt.Errorf("api: unsupported proxy scheme %q", u.Scheme)
+		return a
+	}
+	tr.Proxy = http.ProxyURL(u)
+	a.setTransport(tr)
+	return a
+}
+
+func (a *Agent) configureTLS(configure func(*tls.Config) error) *Agent {
+	tr, err := a.transport()
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+	if err := configure(tr.TLSClientConfig); err != nil {
+		a.Error = err
+		return a
+	}
+	a.setTransport(tr)
+	return a
+}
+
+// TLSInsecureSkipVerify disables the verification of server certificates.
+// Use it for tests and self-signed development servers only.
+func (a *Agent) TLSInsecureSkipVerify(skip bool) *Agent {
+	return a.configureTLS(func(cfg *tls.Config) error {
+		cfg.InsecureSkipVerify = skip
+		return nil
+	})
+}
+
+// TLSRootCAs trusts the PEM encoded certificates in pemBytes, instead of the
+// system roots, to verify servers.
+func (a *Agent) TLSRootCAs(pemBytes []byte) *Agent {
+	return a.configureTLS(func(cfg *tls.Config) error {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return errors.New("api: no certificate found in root CAs pem")
+		}
+		cfg.RootCAs = pool
+		return nil
+	})
+}
+
+// TLSClientCert presents cert to servers requiring mutual TLS.
+func (a *Agent) TLSClientCert(cert tls.Certificate) *Agent {
+	return a.configureTLS(func(cfg *tls.Config) error {
+		cfg.Certificates = append(cfg.Certificates, cert)
+		return nil
+	})
+}
+
+// Pool sizes the connection pool of the transport: idle connections in
+// total and per host, and connections per host, 0 meaning no limit. TLS,
+// proxy and other settings of the transport are kept.
+func (a *Agent) Pool(maxIdle, maxIdlePerHost, maxConnsPerHost int) *Agent {
+	tr, err := a.transport()
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	tr.MaxIdleConns = maxIdle
+	tr.MaxIdleConnsPerHost = maxIdlePerHost
+	tr.MaxConnsPerHost = maxConnsPerHost
+	a.setTransport(tr)
+	return a
+}
+
+// Expect100Continue sends the Expect: 100-continue header, so the body of a
+// large upload is only sent once the server accepted the request headers.
+// A server answering with a final status such as 401 or 417 instead never
+// receives the body. The transport waits up to a second for the answer,
+// unless it has its own ExpectContinueTimeout.
+func (a *Agent) Expect100Continue(enabled bool) *Agent {
+	if !enabled {
+		a.headerIn.Del("Expect")
+		return a
+	}
+	tr, err := a.transport()
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	if tr.ExpectContinueTimeout <= 0 {
+		tr.ExpectContinueTimeout = time.Second
+	}
+	a.setTransport(tr)
+	a.headerIn.Set("Expect", "100-continue")
+	return a
+}
+
+// UnixSocket connects to the unix socket at path for every request, whatever
+// the host of the URL.
+func (a *Agent) UnixSocket(path string) *Agent {
+	tr, err := a.transport()
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	var dialer net.Dialer
+	tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	tr.Proxy = nil
+	a.setTransport(tr)
+	return a
+}
+
+// splitUnixURL splits unix:///path/to.sock:/http/path into the socket path
+// and an http://localhost/http/path URL.
+func splitUnixURL(u *url.URL) (string, *url.URL) {
+	socket, path := u.Path, "/"
+	if i := strings.Index(u.Path, ":"); i >= 0 {
+		socket, path = u.Path[:i], u.Path[i+1:]
+	}
+	return socket, &url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     path,
+		RawQuery: u.RawQuery,
+		Fragment: u.Fragment,
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	shared := &http.Client{}
+	_, text, err := HTTP("origin.invalid").SetClient(shared).URI("/path").Proxy(proxy.URL).Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "proxied http://origin.invalid/path" {
+		t.Errorf("got %q", text)
+	}
+	if shared.Transport != nil {
+		t.Error("shared client transport mutated")
+	}
+
+	if _, _, err := Get(proxy.URL).Proxy("ftp://proxy.invalid").Text(); err == nil {
+		t.Error("expected error for unsupported proxy scheme")
+	}
+
+	agent := Get(proxy.URL).Proxy(proxy.URL).Proxy("")
+	if tr := agent.client.Transport.(*http.Transport); tr.Proxy != nil {
+		t.Error("empty proxy url did not disable the proxy")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "peers %d", len(r.TLS.PeerCertificates))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	if _, _, err := Get(srv.URL).Text(); err == nil {
+		t.Error("expected unknown authority error")
+	}
+
+	_, text, err := Get(srv.URL).TLSInsecureSkipVerify(true).Text()
+	if err != nil || text != "peers 0" {
+		t.Errorf("skip verify: %q, %v", text, err)
+	}
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	_, text, err = Get(srv.URL).TLSRootCAs(ca).Text()
+	if err != nil || text != "peers 0" {
+		t.Errorf("root CAs: %q, %v", text, err)
+	}
+
+	_, text, err = Get(srv.URL).TLSRootCAs(ca).TLSClientCert(srv.TLS.Certificates[0]).Text()
+	if err != nil || text != "peers 1" {
+		t.Errorf("client cert: %q, %v", text, err)
+	}
+
+	if _, _, err := Get(srv.URL).TLSRootCAs([]byte("not pem")).Text(); err == nil {
+		t.Error("expected error for invalid pem")
+	}
+}
+
+func TestPool(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pooled"))
+	}))
+	defer srv.Close()
+
+	agent := Get(srv.URL).TLSInsecureSkipVerify(true).Proxy(srv.URL).Pool(200, 50, 100)
+	tr := agent.client.Transport.(*http.Transport)
+	if tr.MaxIdleConns != 200 || tr.MaxIdleConnsPerHost != 50 || tr.MaxConnsPerHost != 100 {
+		t.Errorf("got pool %d, %d, %d", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost)
+	}
+	if tr.Proxy == nil || tr.TLSClientConfig == nil || !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Error("proxy or TLS settings lost")
+	}
+	if _, text, err := agent.Text(); err != nil || text != "pooled" {
+		t.Errorf("got %q, %v", text, err)
+	}
+
+	if http.DefaultTransport.(*http.Transport).MaxConnsPerHost != 0 {
+		t.Error("default transport mutated")
+	}
+}
+
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(&r.read, int64(n))
+	return n, err
+}
+
+func TestExpect100Continue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Expect") != "100-continue" {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer srv.Close()
+
+	payload := strings.Repeat("x", 1<<20)
+	body := &countingReader{Reader: strings.NewReader(payload)}
+	code, _, err := Put(srv.URL).Stream(body).Expect100Continue(true).Text()
+	if code != http.StatusUnauthorized || err == nil {
+		t.Errorf("rejected: %d, %v", code, err)
+	}
+	if n := atomic.LoadInt64(&body.read); n != 0 {
+		t.Errorf("rejected upload read %d bytes of the body", n)
+	}
+
+	body = &countingReader{Reader: strings.NewReader(payload)}
+	code, text, err := Put(srv.URL).BearerToken("t").Stream(body).Expect100Continue(true).Text()
+	if err != nil || code != http.StatusOK || text != fmt.Sprint(len(payload)) {
+		t.Errorf("accepted: %d, %q, %v", code, text, err)
+	}
+
+	agent := Put(srv.URL).Expect100Continue(true).Expect100Continue(false)
+	if agent.headerIn.Get("Expect") != "" {
+		t.Error("Expect header not removed")
+	}
+}
+
+func TestSetDefaultClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Default")))
+	}))
+	defer srv.Close()
+
+	tr := DefaultTransport()
+	client := &http.Client{Timeout: 5 * time.Second, Transport: RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("X-Default", "yes")
+		return tr.RoundTrip(req)
+	})}
+	SetDefaultClient(client)
+	defer SetDefaultClient(nil)
+
+	agent := Get(srv.URL)
+	if agent.client != client {
+		t.Error("new agent does not use the default client")
+	}
+	if _, text, err := agent.Text(); err != nil || text != "yes" {
+		t.Errorf("got %q, %v", text, err)
+	}
+
+	SetDefaultClient(nil)
+	if Get(srv.URL).client != http.DefaultClient {
+		t.Error("nil did not restore http.DefaultClient")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.URL.Path, r.URL.RawQuery)
+	}))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	_, text, err := Get("unix://"+sock+":/containers/json").QuerySet("all", "1").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "/containers/json all=1" {
+		t.Errorf("got %q", text)
+	}
+
+	_, text, err = Get("unix://" + sock + ":/v1.41").URI("/info").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "/v1.41/info " {
+		t.Errorf("prefix: got %q", text)
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// structValues encodes the exported fields of struct v into url.Values,
+// naming them by the given tag. Tags follow encoding/json conventions:
+// "-" skips a field and ",omitempty" skips zero values. Fields may be
+// strings, numbers, bools, pointers to those or slices of those.
+func structValues(v interface{}, tag string) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return url.Values{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("api: %s values require a struct, got %T", tag, v)
+	}
+
+	values := url.Values{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name, opts := field.Name, ""
+		if t, ok := field.Tag.Lookup(tag); ok {
+			if t == "-" {
+				continue
+			}
+			name, opts = t, ""
+			if idx := strings.Index(t, ","); idx >= 0 {
+				name, opts = t[:idx], t[idx+1:]
+			}
+			if name == "" {
+				name = field.Name
+			}
+		}
+
+		fv := rv.Field(i)
+		if strings.Contains(opts, "omitempty") && isZeroValue(fv) {
+			continue
+		}
+		for fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Ptr {
+			continue
+		}
+
+		if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formatValue(fv.Index(j))
+				if err != nil {
+					return nil, fmt.Errorf("api: field %s: %v", field.Name, err)
+				}
+				values.Add(name, s)
+			}
+			continue
+		}
+
+		s, err := formatValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("api: field %s: %v", field.Name, err)
+		}
+		values.Add(name, s)
+	}
+	return values, nil
+}
+
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func formatValue(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// QueryStruct appends the fields of v, named by their `url:"name"` tags,
+// to the query.
+func (a *Agent) QueryStruct(v interface{}) *Agent {
+	values, err := structValues(v, "url")
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	for k, vs := range values {
+		for _, vv := range vs {
+			a.query.Add(k, vv)
+		}
+	}
+	return a
+}
+
+// QueryStructSet is QueryStruct with Set semantics: the values of every
+// field of v replace the query values of that key, so setting a struct again
+// does not duplicate parameters. Keys skipped by omitempty are left as is.
+func (a *Agent) QueryStructSet(v interface{}) *Agent {
+	values, err := structValues(v, "url")
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	for k, vs := range values {
+		a.query[k] = vs
+	}
+	return a
+}
+
+// FormStruct encodes the fields of v, named by their `form:"name"` tags,
+// as an application/x-www-form-urlencoded body.
+func (a *Agent) FormStruct(v interface{}) *Agent {
+	values, err := structValues(v, "form")
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	return a.FormData(values)
+}
+
+// ArrayStyle selects how QueryArray encodes several values of one key.
+type ArrayStyle int
+
+const (
+	// ArrayRepeat repeats the key: id=1&id=2.
+	ArrayRepeat ArrayStyle = iota
+	// ArrayBrackets suffixes the key with [], as PHP and Rails expect:
+	// id[]=1&id[]=2.
+	ArrayBrackets
+	// ArrayComma joins the values into a single parameter: id=1,2.
+	ArrayComma
+)
+
+// QueryArray sets the query parameter key to values, encoded with style.
+func (a *Agent) QueryArray(key string, values []string, style ArrayStyle) *Agent {
+	a.query.Del(key)
+	a.query.Del(key + "[]")
+	switch style {
+	case ArrayBrackets:
+		a.query[key+"[]"] = append([]string(nil), values...)
+	case ArrayComma:
+		a.query.Set(key, strings.Join(values, ","))
+	default:
+		a.query[key] = append([]string(nil), values...)
+	}
+	return a
+}
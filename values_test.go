@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestQueryStruct(t *testing.T) {
+	type Filter struct {
+		Name    string   `url:"name"`
+		Page    int      `url:"page,omitempty"`
+		Size    uint     `url:"size"`
+		Score   float64  `url:"score,omitempty"`
+		Active  bool     `url:"active"`
+		Tags    []string `url:"tag,omitempty"`
+		Note    *string  `url:"note,omitempty"`
+		Ignored string   `url:"-"`
+		Plain   string
+		hidden  string
+	}
+
+	agent := URL("http://localhost").QueryAdd("name", "first")
+	agent.QueryStruct(Filter{
+		Name:    "second",
+		Size:    20,
+		Active:  true,
+		Tags:    []string{"a", "b"},
+		Ignored: "x",
+		Plain:   "p",
+		hidden:  "h",
+	})
+	if agent.Error != nil {
+		t.Fatal(agent.Error)
+	}
+
+	want := map[string][]string{
+		"name":   {"first", "second"},
+		"size":   {"20"},
+		"active": {"true"},
+		"tag":    {"a", "b"},
+		"Plain":  {"p"},
+	}
+	if got := agent.QueryGet(); !reflect.DeepEqual(map[string][]string(got), want) {
+		t.Errorf("got query %v, want %v", got, want)
+	}
+
+	agent = URL("http://localhost").QueryStruct(struct {
+		Bad map[string]string `url:"bad"`
+	}{Bad: map[string]string{"a": "b"}})
+	if agent.Error == nil {
+		t.Error("expected unsupported field type error")
+	}
+}
+
+func TestFormStruct(t *testing.T) {
+	type Login struct {
+		User     string   `form:"user"`
+		Password string   `form:"password"`
+		Remember bool     `form:"remember,omitempty"`
+		Scopes   []string `form:"scope"`
+		Code     int      `form:"code,omitempty"`
+	}
+
+	agent := Post("http://localhost").FormStruct(&Login{
+		User:     "jp",
+		Password: "p&ss word",
+		Scopes:   []string{"read", "write"},
+	})
+	if agent.Error != nil {
+		t.Fatal(agent.Error)
+	}
+
+	want := url.Values{
+		"user":     {"jp"},
+		"password": {"p&ss word"},
+		"scope":    {"read", "write"},
+	}.Encode()
+	body, _ := ioutil.ReadAll(agent.data)
+	if string(body) != want {
+		t.Errorf("got body %q, want %q", body, want)
+	}
+	if agent.length != len(want) || agent.t != "form" {
+		t.Errorf("got length %d type %q", agent.length, agent.t)
+	}
+}
+
+func TestQueryArray(t *testing.T) {
+	styles := map[ArrayStyle]string{
+		ArrayRepeat:   "id=1&id=2",
+		ArrayBrackets: "id%5B%5D=1&id%5B%5D=2",
+		ArrayComma:    "id=1%2C2",
+	}
+	for style, want := range styles {
+		req, err := URL("http://localhost").QueryArray("id", []string{"1", "2"}, style).Request(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.URL.RawQuery != want {
+			t.Errorf("style %d: got %q, want %q", style, req.URL.RawQuery, want)
+		}
+	}
+}
+
+func TestSetQuery(t *testing.T) {
+	incoming, _ := url.ParseQuery("tag=a&tag=b&page=2")
+	agent := URL("http://localhost").QueryAdd("tag", "x").SetQuery(incoming)
+	want := map[string][]string{
+		"tag":  {"x", "a", "b"},
+		"page": {"2"},
+	}
+	if got := agent.QueryGet(); !reflect.DeepEqual(map[string][]string(got), want) {
+		t.Errorf("got query %v, want %v", got, want)
+	}
+}
+
+func TestQueryStructSet(t *testing.T) {
+	type Filter struct {
+		Page int      `url:"page"`
+		Tags []string `url:"tag,omitempty"`
+	}
+
+	agent := URL("http://localhost").QuerySet("q", "x").
+		QueryStructSet(Filter{Page: 1, Tags: []string{"a", "b"}}).
+		QueryStructSet(Filter{Page: 2, Tags: []string{"c"}})
+	want := map[string][]string{
+		"q":    {"x"},
+		"page": {"2"},
+		"tag":  {"c"},
+	}
+	if got := agent.QueryGet(); !reflect.DeepEqual(map[string][]string(got), want) {
+		t.Errorf("got query %v, want %v", got, want)
+	}
+}